@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tracks
+    ADD COLUMN IF NOT EXISTS storage_key VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS size BIGINT,
+    ADD COLUMN IF NOT EXISTS mime_type VARCHAR(127),
+    ADD COLUMN IF NOT EXISTS checksum CHAR(64);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tracks
+    DROP COLUMN IF EXISTS checksum,
+    DROP COLUMN IF EXISTS mime_type,
+    DROP COLUMN IF EXISTS size,
+    DROP COLUMN IF EXISTS storage_key;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tracks
+    ADD COLUMN IF NOT EXISTS album VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS track_number INTEGER,
+    ADD COLUMN IF NOT EXISTS year INTEGER,
+    ADD COLUMN IF NOT EXISTS genre VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS duration_ms INTEGER,
+    ADD COLUMN IF NOT EXISTS cover_key VARCHAR(255);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tracks
+    DROP COLUMN IF EXISTS cover_key,
+    DROP COLUMN IF EXISTS duration_ms,
+    DROP COLUMN IF EXISTS genre,
+    DROP COLUMN IF EXISTS year,
+    DROP COLUMN IF EXISTS track_number,
+    DROP COLUMN IF EXISTS album;
+-- +goose StatementEnd
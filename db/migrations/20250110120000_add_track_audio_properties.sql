@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tracks
+    ADD COLUMN IF NOT EXISTS bitrate INTEGER,
+    ADD COLUMN IF NOT EXISTS codec VARCHAR(32),
+    ADD COLUMN IF NOT EXISTS sample_rate INTEGER,
+    ADD COLUMN IF NOT EXISTS channels SMALLINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tracks
+    DROP COLUMN IF EXISTS channels,
+    DROP COLUMN IF EXISTS sample_rate,
+    DROP COLUMN IF EXISTS codec,
+    DROP COLUMN IF EXISTS bitrate;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS track_reactions (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    track_id INTEGER NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, track_id)
+);
+
+CREATE INDEX IF NOT EXISTS track_reactions_track_id_idx ON track_reactions (track_id);
+
+-- Counters used to be written by clients; from now on they are derived
+-- from track_reactions, which starts out empty.
+UPDATE tracks SET likes = 0, dislikes = 0;
+
+ALTER TABLE tracks
+    ALTER COLUMN likes SET DEFAULT 0,
+    ALTER COLUMN likes SET NOT NULL,
+    ALTER COLUMN dislikes SET DEFAULT 0,
+    ALTER COLUMN dislikes SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tracks
+    ALTER COLUMN likes DROP NOT NULL,
+    ALTER COLUMN likes DROP DEFAULT,
+    ALTER COLUMN dislikes DROP NOT NULL,
+    ALTER COLUMN dislikes DROP DEFAULT;
+
+DROP TABLE IF EXISTS track_reactions;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Everyone starts out as a listener. The first administrator has to be
+-- promoted by hand: UPDATE users SET role = 'admin' WHERE login = '...';
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'listener'
+        CHECK (role IN ('admin', 'artist', 'listener'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
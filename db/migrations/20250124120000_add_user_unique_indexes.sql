@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Earlier versions accepted duplicates. The oldest account keeps the login
+-- or email; later ones are renamed so the indexes can be built, and have to
+-- pick a new login or verify a new address. A renamed value may already be
+-- taken by another account, so a counter is added until it is free. Values
+-- are shortened to keep the suffix within the 255 characters of the columns.
+DO $$
+DECLARE
+    dup RECORD;
+    suffix TEXT;
+    candidate TEXT;
+    n INTEGER;
+BEGIN
+    FOR dup IN
+        SELECT u.id, u.login FROM users u
+        WHERE EXISTS (SELECT 1 FROM users o WHERE o.login = u.login AND o.id < u.id)
+        ORDER BY u.id
+    LOOP
+        suffix := '-' || dup.id;
+        candidate := left(dup.login, 255 - length(suffix)) || suffix;
+        n := 1;
+        WHILE EXISTS (SELECT 1 FROM users WHERE login = candidate) LOOP
+            n := n + 1;
+            suffix := '-' || dup.id || '-' || n;
+            candidate := left(dup.login, 255 - length(suffix)) || suffix;
+        END LOOP;
+
+        UPDATE users SET login = candidate WHERE id = dup.id;
+    END LOOP;
+
+    FOR dup IN
+        SELECT u.id, u.email FROM users u
+        WHERE EXISTS (SELECT 1 FROM users o WHERE lower(o.email) = lower(u.email) AND o.id < u.id)
+        ORDER BY u.id
+    LOOP
+        suffix := '.' || dup.id || '.invalid';
+        candidate := left(dup.email, 255 - length(suffix)) || suffix;
+        n := 1;
+        WHILE EXISTS (SELECT 1 FROM users WHERE lower(email) = lower(candidate)) LOOP
+            n := n + 1;
+            suffix := '.' || dup.id || '-' || n || '.invalid';
+            candidate := left(dup.email, 255 - length(suffix)) || suffix;
+        END LOOP;
+
+        UPDATE users SET email = candidate, email_verified_at = NULL WHERE id = dup.id;
+    END LOOP;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_unique_idx ON users (login);
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_unique_idx ON users (lower(email));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_email_unique_idx;
+DROP INDEX IF EXISTS users_login_unique_idx;
+-- +goose StatementEnd
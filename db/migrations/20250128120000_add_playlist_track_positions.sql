@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE playlist_tracks
+    ADD COLUMN IF NOT EXISTS position INTEGER;
+
+UPDATE playlist_tracks pt
+SET position = ordered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY playlist_id ORDER BY id) - 1 AS position
+    FROM playlist_tracks
+) ordered
+WHERE pt.id = ordered.id;
+
+ALTER TABLE playlist_tracks
+    ALTER COLUMN position SET NOT NULL;
+
+-- Reordering shifts several entries at once, so uniqueness is only checked
+-- at commit.
+ALTER TABLE playlist_tracks
+    ADD CONSTRAINT playlist_tracks_position_unique UNIQUE (playlist_id, position)
+    DEFERRABLE INITIALLY DEFERRED;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE playlist_tracks DROP CONSTRAINT IF EXISTS playlist_tracks_position_unique;
+
+ALTER TABLE playlist_tracks DROP COLUMN IF EXISTS position;
+-- +goose StatementEnd
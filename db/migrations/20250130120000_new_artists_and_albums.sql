@@ -0,0 +1,81 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS artists (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS artists_name_idx ON artists (lower(name));
+
+CREATE TABLE IF NOT EXISTS albums (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    artist_id INTEGER REFERENCES artists(id) ON DELETE SET NULL,
+    release_date DATE,
+    cover_key VARCHAR(255),
+    owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS albums_artist_id_idx ON albums (artist_id);
+
+CREATE TABLE IF NOT EXISTS track_artists (
+    track_id INTEGER NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    artist_id INTEGER NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('primary', 'featured', 'remixer')),
+    position INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (track_id, artist_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS track_artists_artist_id_idx ON track_artists (artist_id);
+
+ALTER TABLE tracks
+    ADD COLUMN IF NOT EXISTS album_id INTEGER REFERENCES albums(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS disc_number INTEGER;
+
+CREATE INDEX IF NOT EXISTS tracks_album_id_idx ON tracks (album_id);
+
+-- Every distinct artist and album string becomes an entity. Spellings that
+-- differ only in case are merged into the first one seen.
+INSERT INTO artists (name)
+SELECT DISTINCT ON (lower(artist)) artist
+FROM tracks
+WHERE artist <> ''
+ORDER BY lower(artist), id;
+
+INSERT INTO track_artists (track_id, artist_id, role)
+SELECT t.id, a.id, 'primary'
+FROM tracks t
+JOIN artists a ON lower(a.name) = lower(t.artist);
+
+INSERT INTO albums (title, artist_id)
+SELECT DISTINCT ON (lower(t.album), a.id) t.album, a.id
+FROM tracks t
+LEFT JOIN artists a ON lower(a.name) = lower(t.artist)
+WHERE COALESCE(t.album, '') <> ''
+ORDER BY lower(t.album), a.id, t.id;
+
+UPDATE tracks t
+SET album_id = al.id
+FROM albums al
+LEFT JOIN artists a ON a.id = al.artist_id
+WHERE lower(al.title) = lower(t.album)
+    AND (lower(a.name) = lower(t.artist) OR (al.artist_id IS NULL AND t.artist = ''));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS tracks_album_id_idx;
+
+ALTER TABLE tracks
+    DROP COLUMN IF EXISTS disc_number,
+    DROP COLUMN IF EXISTS album_id;
+
+DROP TABLE IF EXISTS track_artists;
+DROP TABLE IF EXISTS albums;
+DROP TABLE IF EXISTS artists;
+-- +goose StatementEnd
@@ -0,0 +1,73 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent() is only STABLE because its dictionary can be changed, which
+-- keeps it out of index expressions. Pinning the dictionary makes the
+-- wrapper safe to mark IMMUTABLE.
+CREATE OR REPLACE FUNCTION immutable_unaccent(TEXT) RETURNS TEXT AS $$
+    SELECT public.unaccent('public.unaccent'::REGDICTIONARY, $1)
+$$ LANGUAGE SQL IMMUTABLE PARALLEL SAFE STRICT;
+
+-- Titles and names are in many languages, so words are folded to lower case
+-- without accents but not stemmed.
+-- CREATE TEXT SEARCH CONFIGURATION has no IF NOT EXISTS.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'music') THEN
+        CREATE TEXT SEARCH CONFIGURATION music (COPY = simple);
+    END IF;
+END
+$$;
+ALTER TEXT SEARCH CONFIGURATION music
+    ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('music', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('music', COALESCE(artist, '')), 'B') ||
+    setweight(to_tsvector('music', COALESCE(album, '')), 'C')
+) STORED;
+
+ALTER TABLE artists ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('music', name)
+) STORED;
+
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('music', title)
+) STORED;
+
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('music', name)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS tracks_search_idx ON tracks USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS artists_search_idx ON artists USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS albums_search_idx ON albums USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS playlists_search_idx ON playlists USING GIN (search_vector);
+
+-- Trigram indexes catch typos and partially typed words that full-text
+-- search misses.
+CREATE INDEX IF NOT EXISTS tracks_name_trgm_idx ON tracks USING GIN (immutable_unaccent(lower(name)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS tracks_artist_trgm_idx ON tracks USING GIN (immutable_unaccent(lower(artist)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS artists_name_trgm_idx ON artists USING GIN (immutable_unaccent(lower(name)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS albums_title_trgm_idx ON albums USING GIN (immutable_unaccent(lower(title)) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS playlists_name_trgm_idx ON playlists USING GIN (immutable_unaccent(lower(name)) gin_trgm_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS playlists_name_trgm_idx;
+DROP INDEX IF EXISTS albums_title_trgm_idx;
+DROP INDEX IF EXISTS artists_name_trgm_idx;
+DROP INDEX IF EXISTS tracks_artist_trgm_idx;
+DROP INDEX IF EXISTS tracks_name_trgm_idx;
+
+ALTER TABLE playlists DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE albums DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE artists DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE tracks DROP COLUMN IF EXISTS search_vector;
+
+DROP TEXT SEARCH CONFIGURATION IF EXISTS music;
+DROP FUNCTION IF EXISTS immutable_unaccent(TEXT);
+-- +goose StatementEnd
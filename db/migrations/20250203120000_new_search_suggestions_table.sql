@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- search_suggestions holds the names offered while a search is being typed.
+-- Track rows carry both the track name and its artist, playlist rows the
+-- playlist name. term is the folded label that prefixes are matched against.
+CREATE TABLE IF NOT EXISTS search_suggestions (
+    id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('track', 'artist', 'playlist')),
+    track_id INT REFERENCES tracks(id) ON DELETE CASCADE,
+    playlist_id INT REFERENCES playlists(id) ON DELETE CASCADE,
+    label TEXT NOT NULL,
+    term TEXT NOT NULL,
+    CHECK ((track_id IS NULL) <> (playlist_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS search_suggestions_prefix_idx ON search_suggestions (kind, term text_pattern_ops);
+CREATE INDEX IF NOT EXISTS search_suggestions_track_id_idx ON search_suggestions (track_id);
+CREATE INDEX IF NOT EXISTS search_suggestions_playlist_id_idx ON search_suggestions (playlist_id);
+
+INSERT INTO search_suggestions (kind, track_id, label, term)
+SELECT k.kind, t.id, k.label, immutable_unaccent(lower(k.label))
+FROM tracks t, LATERAL (VALUES ('track', btrim(t.name)), ('artist', btrim(t.artist))) AS k(kind, label)
+WHERE k.label <> '';
+
+INSERT INTO search_suggestions (kind, playlist_id, label, term)
+SELECT 'playlist', p.id, btrim(p.name), immutable_unaccent(lower(btrim(p.name)))
+FROM playlists p
+WHERE btrim(p.name) <> '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS search_suggestions;
+-- +goose StatementEnd
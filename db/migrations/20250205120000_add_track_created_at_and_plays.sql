@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Tracks added before this migration did not record when, so they all get
+-- the time of the migration.
+ALTER TABLE tracks
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS plays INTEGER NOT NULL DEFAULT 0;
+
+-- Every sortable column is indexed together with the id that breaks ties,
+-- so that each page of a sorted listing is an index range scan.
+CREATE INDEX IF NOT EXISTS tracks_name_sort_idx ON tracks (lower(name), id);
+CREATE INDEX IF NOT EXISTS tracks_artist_sort_idx ON tracks (lower(artist), id);
+CREATE INDEX IF NOT EXISTS tracks_likes_sort_idx ON tracks (likes, id);
+CREATE INDEX IF NOT EXISTS tracks_created_at_sort_idx ON tracks (created_at, id);
+CREATE INDEX IF NOT EXISTS tracks_duration_sort_idx ON tracks (COALESCE(duration_ms, 0), id);
+CREATE INDEX IF NOT EXISTS tracks_plays_sort_idx ON tracks (plays, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS tracks_plays_sort_idx;
+DROP INDEX IF EXISTS tracks_duration_sort_idx;
+DROP INDEX IF EXISTS tracks_created_at_sort_idx;
+DROP INDEX IF EXISTS tracks_likes_sort_idx;
+DROP INDEX IF EXISTS tracks_artist_sort_idx;
+DROP INDEX IF EXISTS tracks_name_sort_idx;
+
+ALTER TABLE tracks
+    DROP COLUMN IF EXISTS plays,
+    DROP COLUMN IF EXISTS created_at;
+-- +goose StatementEnd
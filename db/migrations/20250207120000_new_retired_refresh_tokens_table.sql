@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Refresh tokens rotated out of a session are remembered, so that a replayed
+-- one can be recognised and the session it was stolen from revoked.
+CREATE TABLE IF NOT EXISTS retired_refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    retired_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS retired_refresh_tokens_session_id_idx ON retired_refresh_tokens (session_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS retired_refresh_tokens;
+-- +goose StatementEnd
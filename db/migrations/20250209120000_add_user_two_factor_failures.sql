@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Invalid two-factor codes are counted per account, so that the code cannot
+-- be guessed by retrying a login with a known password.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_failures INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS totp_failed_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_failed_at,
+    DROP COLUMN IF EXISTS totp_failures;
+-- +goose StatementEnd
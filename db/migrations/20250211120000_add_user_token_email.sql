@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A token is only good for the address it was sent to. Which address the
+-- outstanding ones went to is not known, so they have to be asked for again.
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS email TEXT;
+
+UPDATE user_tokens SET used_at = NOW() WHERE used_at IS NULL;
+
+UPDATE user_tokens t SET email = u.email FROM users u WHERE u.id = t.user_id;
+
+ALTER TABLE user_tokens ALTER COLUMN email SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS email;
+-- +goose StatementEnd
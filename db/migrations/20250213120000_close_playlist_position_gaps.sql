@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleting a track used to leave a gap where its playlist entries were, and
+-- positions are expected to run from 0 without gaps.
+UPDATE playlist_tracks pt
+SET position = ordered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY playlist_id ORDER BY position) - 1 AS position
+    FROM playlist_tracks
+) ordered
+WHERE pt.id = ordered.id AND pt.position <> ordered.position;
+-- +goose StatementEnd
+
+-- +goose Down
+-- The entries keep their order, so there is nothing to undo.
@@ -1,17 +1,28 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	_ "music-hosting/docs"
+	"music-hosting/internal/auth"
 	"music-hosting/internal/config"
+	"music-hosting/internal/http/album"
+	"music-hosting/internal/http/artist"
+	"music-hosting/internal/http/jwks"
 	"music-hosting/internal/http/playlist"
+	"music-hosting/internal/http/search"
 	"music-hosting/internal/http/track"
 	"music-hosting/internal/http/user"
+	"music-hosting/internal/mailer"
 	"music-hosting/internal/middleware"
+	"music-hosting/internal/models"
 	"music-hosting/internal/repository"
 	"music-hosting/internal/service"
+	"music-hosting/internal/storage/blob"
+	"music-hosting/internal/storage/local"
 	"music-hosting/internal/storage/postgresql"
+	"music-hosting/internal/storage/s3"
 	"os"
 
 	"github.com/gin-gonic/gin"
@@ -42,50 +53,189 @@ func Run(configPath string) error {
 		return fmt.Errorf("failed to create user storage: %w", err)
 	}
 
-	userSvc := service.NewUserService(userStorage, logger)
+	sessionStorage, err := repository.NewSessionStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to create session storage: %w", err)
+	}
+
+	keyManager, err := auth.NewKeyManager(&cfg.Auth, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	go keyManager.Run(context.Background())
+
+	userTokenStorage, err := repository.NewUserTokenStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to create user token storage: %w", err)
+	}
+
+	txManager, err := repository.NewTxManager(db)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction manager: %w", err)
+	}
+
+	mail, err := newMailer(&cfg.Mail, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create mailer: %w", err)
+	}
+
+	userSvc := service.NewUserService(
+		userStorage,
+		sessionStorage,
+		userTokenStorage,
+		txManager,
+		keyManager,
+		mail,
+		&cfg.Auth,
+		cfg.Server.PublicURL,
+		logger,
+	)
 	userHandler := user.NewHandler(userSvc, logger)
+	jwksHandler := jwks.NewHandler(keyManager)
 
 	trackStorage, err := repository.NewTrackStorage(db)
 	if err != nil {
 		return fmt.Errorf("failed to create track storage: %w", err)
 	}
 
-	trackSvc := service.NewTrackService(trackStorage, logger)
+	mediaStorage, err := newBlobStore(&cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to create media storage: %w", err)
+	}
+
+	reactionStorage, err := repository.NewReactionStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to create reaction storage: %w", err)
+	}
+
+	artistStorage, err := repository.NewArtistStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to create artist storage: %w", err)
+	}
+
+	albumStorage, err := repository.NewAlbumStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to create album storage: %w", err)
+	}
+
+	trackSvc := service.NewTrackService(
+		trackStorage,
+		reactionStorage,
+		userStorage,
+		artistStorage,
+		albumStorage,
+		txManager,
+		mediaStorage,
+		logger,
+	)
 	trackHandler := track.NewHandler(trackSvc, logger)
 
+	artistSvc := service.NewArtistService(artistStorage, logger)
+	artistHandler := artist.NewHandler(artistSvc, logger)
+
+	albumSvc := service.NewAlbumService(albumStorage, mediaStorage, logger)
+	albumHandler := album.NewHandler(albumSvc, logger)
+
 	playlistStorage, err := repository.NewPlaylistStorage(db)
 	if err != nil {
 		return fmt.Errorf("failed to create playlist storage: %w", err)
 	}
 
-	playlistSvc := service.NewPlaylistService(playlistStorage, logger)
+	playlistSvc := service.NewPlaylistService(playlistStorage, artistStorage, txManager, logger)
 	playlistHandler := playlist.NewHandler(playlistSvc, logger)
 
+	searchStorage, err := repository.NewSearchStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to create search storage: %w", err)
+	}
+
+	searchSvc := service.NewSearchService(searchStorage, artistStorage, logger)
+	searchHandler := search.NewHandler(searchSvc, logger)
+
 	router := gin.Default()
 
 	router.POST("/users", userHandler.CreateUser())
-	router.POST("/tracks", trackHandler.CreateTrack())
-	router.POST("/playlists", playlistHandler.CreatePlaylist())
 	router.POST("/login", userHandler.Login())
+	router.POST("/login/2fa", userHandler.LoginTwoFactor())
+	router.POST("/auth/refresh", userHandler.RefreshToken())
+	router.POST("/auth/logout", middleware.Auth(keyManager, userSvc), userHandler.Logout())
+	router.POST("/auth/logout-all", middleware.Auth(keyManager, userSvc), userHandler.LogoutAll())
+	router.GET("/auth/verify-email", userHandler.VerifyEmail())
+	router.POST("/auth/verify-email", userHandler.VerifyEmail())
+	router.POST("/auth/forgot-password", userHandler.ForgotPassword())
+	router.POST("/auth/reset-password", userHandler.ResetPassword())
+	router.GET("/.well-known/jwks.json", jwksHandler.GetJWKS())
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	routes := router.Group("/api/v1")
-	routes.Use(middleware.Auth())
+	routes.Use(middleware.Auth(keyManager, userSvc))
 	{
+		routes.GET("/me", userHandler.GetMe())
+		routes.PATCH("/me", userHandler.UpdateMe())
+		routes.DELETE("/me", userHandler.DeleteMe())
+		routes.PUT("/me/password", userHandler.ChangePassword())
+		routes.GET("/me/playlists", playlistHandler.GetMyPlaylists())
+		routes.GET("/me/tracks", trackHandler.GetMyTracks())
+
 		routes.GET("/users/:id", userHandler.GetUserID())
 		routes.GET("/users", userHandler.GetUserWithPagination())
 		routes.PUT("/users/:id", userHandler.UpdateUser())
+		routes.PATCH("/users/:id", userHandler.PatchUser())
 		routes.DELETE("/users/:id", userHandler.DeleteUser())
+		routes.POST("/users/me/verification-email", userHandler.ResendVerificationEmail())
+		routes.POST("/users/me/2fa", userHandler.EnrollTwoFactor())
+		routes.POST("/users/me/2fa/verify", userHandler.ConfirmTwoFactor())
+		routes.DELETE("/users/me/2fa", userHandler.DisableTwoFactor())
+		routes.PUT("/users/:id/role", middleware.RequireRole(models.RoleAdmin), userHandler.UpdateUserRole())
 
+		routes.POST(
+			"/tracks",
+			middleware.RequireRole(models.RoleArtist, models.RoleAdmin),
+			middleware.MaxBodySize(cfg.Server.MaxUploadSize),
+			trackHandler.CreateTrack(),
+		)
+		routes.GET("/tracks/liked", trackHandler.GetLikedTracks())
 		routes.GET("/tracks/:id", trackHandler.GetTrackByID())
+		routes.GET("/tracks/:id/stream", trackHandler.StreamTrack())
+		routes.HEAD("/tracks/:id/stream", trackHandler.StreamTrack())
+		routes.GET("/tracks/:id/cover", trackHandler.GetTrackCover())
 		routes.GET("/tracks", trackHandler.GetTracks())
 		routes.PUT("/tracks/:id", trackHandler.UpdateTrack())
+		routes.PATCH("/tracks/:id", trackHandler.PatchTrack())
 		routes.DELETE("/tracks/:id", trackHandler.DeleteTrack())
+		routes.PUT("/tracks/:id/reaction", trackHandler.SetReaction())
+		routes.DELETE("/tracks/:id/reaction", trackHandler.RemoveReaction())
+		routes.PUT("/tracks/:id/artists", trackHandler.SetTrackArtists())
+
+		routes.POST("/artists", middleware.RequireRole(models.RoleArtist, models.RoleAdmin), artistHandler.CreateArtist())
+		routes.GET("/artists", artistHandler.GetArtists())
+		routes.GET("/artists/:id", artistHandler.GetArtist())
+		routes.PUT("/artists/:id", artistHandler.UpdateArtist())
+		routes.DELETE("/artists/:id", artistHandler.DeleteArtist())
+		routes.GET("/artists/:id/tracks", trackHandler.GetArtistTracks())
+		routes.GET("/artists/:id/albums", albumHandler.GetArtistAlbums())
+
+		routes.POST("/albums", middleware.RequireRole(models.RoleArtist, models.RoleAdmin), albumHandler.CreateAlbum())
+		routes.GET("/albums", albumHandler.GetAlbums())
+		routes.GET("/albums/:id", albumHandler.GetAlbum())
+		routes.PUT("/albums/:id", albumHandler.UpdateAlbum())
+		routes.DELETE("/albums/:id", albumHandler.DeleteAlbum())
+		routes.GET("/albums/:id/tracks", trackHandler.GetAlbumTracks())
+		routes.GET("/albums/:id/cover", albumHandler.GetAlbumCover())
+		routes.PUT("/albums/:id/cover", middleware.MaxBodySize(cfg.Server.MaxUploadSize), albumHandler.SetAlbumCover())
 
+		routes.GET("/search", searchHandler.Search())
+		routes.GET("/search/suggest", searchHandler.Suggest())
+
+		routes.POST("/playlists", playlistHandler.CreatePlaylist())
 		routes.GET("/playlists/:id", playlistHandler.GetPlaylistByID())
 		routes.GET("/playlists", playlistHandler.GetPlaylists())
 		routes.PUT("/playlists/:id", playlistHandler.UpdatePlaylist())
+		routes.PATCH("/playlists/:id", playlistHandler.PatchPlaylist())
 		routes.DELETE("/playlists/:id", playlistHandler.DeletePlaylist())
+		routes.POST("/playlists/:id/tracks", playlistHandler.InsertPlaylistTracks())
+		routes.POST("/playlists/:id/tracks/move", playlistHandler.MovePlaylistTracks())
+		routes.DELETE("/playlists/:id/tracks/:entryID", playlistHandler.RemovePlaylistEntry())
 	}
 
 	if err = router.Run(fmt.Sprintf(":%s", cfg.Server.Port)); err != nil {
@@ -94,3 +244,27 @@ func Run(configPath string) error {
 
 	return nil
 }
+
+func newMailer(cfg *config.MailConfig, logger *slog.Logger) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case "", "log":
+		return mailer.NewLogMailer(logger), nil
+	case "file":
+		return mailer.NewFileMailer(cfg.File.Path, cfg.From)
+	case "smtp":
+		return mailer.NewSMTPMailer(&cfg.SMTP, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %q", cfg.Driver)
+	}
+}
+
+func newBlobStore(cfg *config.StorageConfig) (blob.Store, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return local.NewStorage(cfg.Local.Path)
+	case "s3":
+		return s3.NewStorage(&cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %q", cfg.Driver)
+	}
+}
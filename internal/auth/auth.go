@@ -1,48 +1,100 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"log"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/joho/godotenv"
 )
 
-func init() {
-	err := godotenv.Load()
+const challengeTokenType = "2fa_challenge"
+
+type Claims struct {
+	ID        string
+	UserID    int
+	Role      string
+	SessionID int
+}
+
+// GenerateToken issues an access token for the given session that expires
+// after ttl. It is signed with the current key and carries its kid; a random
+// jti is assigned to every token.
+func (m *KeyManager) GenerateToken(userID int, role string, sessionID int, ttl time.Duration) (string, error) {
+	jti, err := randomString(16)
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		return "", err
+	}
+
+	claims := jwt.MapClaims{
+		"jti":     jti,
+		"user_id": userID,
+		"role":    role,
+		"sid":     sessionID,
+		"exp":     time.Now().Add(ttl).Unix(),
 	}
+
+	return m.sign(claims)
 }
 
-var secretKey = []byte(os.Getenv("JWT_SECRET_KEY"))
+// ValidateToken verifies an access token against whichever active key its
+// kid header refers to.
+func (m *KeyManager) ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := claims["typ"]; ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	// Tokens that are not bound to a session cannot be revoked and are
+	// no longer accepted.
+	sessionID, ok := claims["sid"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	jti, _ := claims["jti"].(string)
+	role, _ := claims["role"].(string)
+
+	return &Claims{
+		ID:        jti,
+		UserID:    int(userID),
+		Role:      role,
+		SessionID: int(sessionID),
+	}, nil
+}
 
-func GenerateToken(userID int) (string, error) {
+// GenerateChallengeToken issues a token proving that userID passed the
+// password step of a two-factor login. It cannot be used as an access token.
+func (m *KeyManager) GenerateChallengeToken(userID int, ttl time.Duration) (string, error) {
 	claims := jwt.MapClaims{
+		"typ":     challengeTokenType,
 		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"exp":     time.Now().Add(ttl).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secretKey)
+	return m.sign(claims)
 }
 
-func ValidateToken(tokenString string) (int, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return secretKey, nil
-	})
-
+// ValidateChallengeToken returns the user a challenge token was issued for.
+func (m *KeyManager) ValidateChallengeToken(tokenString string) (int, error) {
+	claims, err := m.parse(tokenString)
 	if err != nil {
 		return 0, err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || !token.Valid {
+	if claims["typ"] != challengeTokenType {
 		return 0, fmt.Errorf("invalid token")
 	}
 
@@ -53,3 +105,60 @@ func ValidateToken(tokenString string) (int, error) {
 
 	return int(userID), nil
 }
+
+func (m *KeyManager) sign(claims jwt.MapClaims) (string, error) {
+	key := m.signingKey()
+	if key == nil {
+		return "", fmt.Errorf("no signing key available")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+func (m *KeyManager) parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := m.verificationKey(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return key.private.Public(), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// GenerateOpaqueToken returns a random token for refresh, email
+// verification and password reset links.
+func GenerateOpaqueToken() (string, error) {
+	return randomString(32)
+}
+
+// HashOpaqueToken returns the form in which opaque tokens are stored, so
+// that a leaked database table cannot be used to present them.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,387 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"music-hosting/internal/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+
+	rsaKeyBits = 2048
+	keyFileExt = ".pem"
+)
+
+// JWKSMaxAge is how long consumers may cache the JWKS.
+const JWKSMaxAge = 5 * time.Minute
+
+const (
+	defaultRotationInterval = 30 * 24 * time.Hour
+
+	// keyRefreshInterval is how often every instance reloads the key
+	// directory.
+	keyRefreshInterval = time.Minute
+	// keyPublishLead is how long before taking over a new key is
+	// published: long enough for every instance to load it and for every
+	// cached copy of the JWKS to expire.
+	keyPublishLead = JWKSMaxAge + keyRefreshInterval
+	// unknownKeyRefreshInterval bounds how often a token with an unknown
+	// kid can make an instance reload the key directory.
+	unknownKeyRefreshInterval = 5 * time.Second
+)
+
+type signingKey struct {
+	id string
+	// created is when the key takes over signing, which for a freshly
+	// published key lies in the future.
+	created time.Time
+	private crypto.Signer
+	method  jwt.SigningMethod
+}
+
+// KeyManager holds the asymmetric keys used to sign and verify access
+// tokens. Keys are stored as PKCS#8 PEM files named after their kid, so
+// every instance sharing the directory signs and verifies with the same
+// set. A new key is published a little before it takes over signing; older
+// keys keep verifying until the tokens they signed have expired, after which
+// they are removed.
+type KeyManager struct {
+	dir       string
+	algorithm string
+	rotation  time.Duration
+	retention time.Duration
+	logger    *slog.Logger
+
+	refreshMu sync.Mutex
+
+	unknownMu          sync.Mutex
+	lastUnknownRefresh time.Time
+
+	mu   sync.RWMutex
+	keys []*signingKey
+}
+
+func NewKeyManager(cfg *config.AuthConfig, logger *slog.Logger) (*KeyManager, error) {
+	algorithm := cfg.SigningAlgorithm
+	if algorithm == "" {
+		algorithm = AlgorithmEdDSA
+	}
+	if algorithm != AlgorithmEdDSA && algorithm != AlgorithmRS256 {
+		return nil, fmt.Errorf("unsupported signing algorithm: %q", algorithm)
+	}
+
+	rotation := cfg.KeyRotationInterval
+	if rotation <= 0 {
+		rotation = defaultRotationInterval
+	}
+
+	// Retired keys have to outlive the tokens they signed.
+	retention := cfg.AccessTokenTTL
+	if retention <= 0 {
+		retention = config.DefaultAccessTokenTTL
+	}
+
+	if err := os.MkdirAll(cfg.KeysDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create keys directory: %w", err)
+	}
+
+	m := &KeyManager{
+		dir:       cfg.KeysDir,
+		algorithm: algorithm,
+		rotation:  rotation,
+		retention: retention,
+		logger:    logger,
+	}
+
+	if err := m.refresh(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Run reloads the key directory periodically, rotating the signing key once
+// it is older than the rotation interval, until ctx is cancelled.
+func (m *KeyManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.refresh(); err != nil {
+				m.logger.Error("Failed to refresh signing keys", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// Rotate publishes a new signing key that takes over once it has had time to
+// reach every verifier. Tokens signed with the previous key stay valid until
+// they expire.
+func (m *KeyManager) Rotate() error {
+	if _, err := m.generateKey(time.Now().Add(keyPublishLead)); err != nil {
+		return err
+	}
+	return m.refresh()
+}
+
+func (m *KeyManager) refresh() error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	keys, err := m.loadKeys()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if len(keys) == 0 {
+		key, err := m.generateKey(now)
+		if err != nil {
+			return err
+		}
+		m.logger.Info("Generated signing key", slog.String("kid", key.id))
+		keys = []*signingKey{key}
+	} else if !keys[0].created.After(now) && now.Sub(keys[0].created) >= m.rotation-keyPublishLead {
+		// The successor is published ahead of signing, so that every
+		// instance and JWKS consumer already knows it by the time tokens
+		// signed with it show up.
+		activation := keys[0].created.Add(m.rotation)
+		if earliest := now.Add(keyPublishLead); activation.Before(earliest) {
+			activation = earliest
+		}
+
+		key, err := m.generateKey(activation)
+		if err != nil {
+			return err
+		}
+		m.logger.Info("Generated signing key", slog.String("kid", key.id), slog.Time("activates_at", activation))
+		keys = append([]*signingKey{key}, keys...)
+	}
+
+	// A key stops signing when its successor takes over, so it only has to
+	// verify tokens issued up to that point.
+	active := keys[:1]
+	for i := 1; i < len(keys); i++ {
+		if now.Sub(keys[i-1].created) > m.retention {
+			m.removeKey(keys[i])
+			continue
+		}
+		active = append(active, keys[i])
+	}
+
+	m.mu.Lock()
+	m.keys = active
+	m.mu.Unlock()
+
+	return nil
+}
+
+// signingKey returns the newest key that has already taken over signing.
+func (m *KeyManager) signingKey() *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range m.keys {
+		if !key.created.After(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// verificationKey returns the key with the given kid. A kid it does not know
+// may belong to a key another instance has just generated, so the directory
+// is reloaded before giving up, at most once per unknownKeyRefreshInterval.
+func (m *KeyManager) verificationKey(kid string) *signingKey {
+	if key := m.findKey(kid); key != nil {
+		return key
+	}
+
+	m.unknownMu.Lock()
+	if time.Since(m.lastUnknownRefresh) < unknownKeyRefreshInterval {
+		m.unknownMu.Unlock()
+		return nil
+	}
+	m.lastUnknownRefresh = time.Now()
+	m.unknownMu.Unlock()
+
+	if err := m.refresh(); err != nil {
+		m.logger.Error("Failed to refresh signing keys", slog.Any("error", err))
+		return nil
+	}
+
+	return m.findKey(kid)
+}
+
+func (m *KeyManager) findKey(kid string) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.id == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// loadKeys reads every key in the directory, newest first.
+func (m *KeyManager) loadKeys() ([]*signingKey, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys directory: %w", err)
+	}
+
+	var keys []*signingKey
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != keyFileExt {
+			continue
+		}
+
+		key, err := m.loadKey(entry)
+		if err != nil {
+			m.logger.Warn("Skipping unreadable signing key", slog.String("file", entry.Name()), slog.Any("error", err))
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].created.After(keys[j].created)
+	})
+
+	return keys, nil
+}
+
+func (m *KeyManager) loadKey(entry os.DirEntry) (*signingKey, error) {
+	info, err := entry.Info()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(m.dir, entry.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		id:      strings.TrimSuffix(entry.Name(), keyFileExt),
+		created: info.ModTime(),
+	}
+
+	switch private := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.private = private
+		key.method = jwt.SigningMethodEdDSA
+	case *rsa.PrivateKey:
+		key.private = private
+		key.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// generateKey stores a new key that takes over signing at activation. The
+// activation time is kept as the file's modification time.
+func (m *KeyManager) generateKey(activation time.Time) (*signingKey, error) {
+	var key signingKey
+
+	switch m.algorithm {
+	case AlgorithmRS256:
+		private, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate rsa key: %w", err)
+		}
+		key.private = private
+		key.method = jwt.SigningMethodRS256
+	default:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ed25519 key: %w", err)
+		}
+		key.private = private
+		key.method = jwt.SigningMethodEdDSA
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	key.id = hex.EncodeToString(id)
+	key.created = activation
+
+	tmp, err := os.CreateTemp(m.dir, ".key-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := pem.Encode(tmp, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	if err := os.Chtimes(tmp.Name(), activation, activation); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(m.dir, key.id+keyFileExt)); err != nil {
+		return nil, fmt.Errorf("failed to store key file: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (m *KeyManager) removeKey(key *signingKey) {
+	err := os.Remove(filepath.Join(m.dir, key.id+keyFileExt))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.logger.Warn("Failed to remove expired signing key", slog.String("kid", key.id), slog.Any("error", err))
+		return
+	}
+	m.logger.Info("Removed expired signing key", slog.String("kid", key.id))
+}
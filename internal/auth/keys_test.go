@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"io"
+	"log/slog"
+	"music-hosting/internal/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestKeyManager(t *testing.T, dir string) *KeyManager {
+	t.Helper()
+
+	cfg := &config.AuthConfig{
+		AccessTokenTTL:      15 * time.Minute,
+		KeysDir:             dir,
+		KeyRotationInterval: 24 * time.Hour,
+	}
+	m, err := NewKeyManager(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	return m
+}
+
+// writeKey stores a key in dir that took or takes over signing at the given
+// offset from now.
+func writeKey(t *testing.T, m *KeyManager, offset time.Duration) string {
+	t.Helper()
+
+	key, err := m.generateKey(time.Now().Add(offset))
+	if err != nil {
+		t.Fatalf("generateKey: %v", err)
+	}
+	return key.id
+}
+
+// takeOver makes m sign with a new key right away, the way an instance that
+// generated it sees it once it is due.
+func takeOver(t *testing.T, m *KeyManager) {
+	t.Helper()
+
+	writeKey(t, m, 0)
+	if err := m.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+}
+
+func jwksKeyIDs(m *KeyManager) []string {
+	var ids []string
+	for _, key := range m.JWKS().Keys {
+		ids = append(ids, key.KeyID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestKeyManagerRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// offsets are the activation times of the keys on disk, relative
+		// to now.
+		offsets []time.Duration
+		// wantSigner is the index into offsets of the key expected to sign.
+		wantSigner int
+		// wantKept are the indexes into offsets still published.
+		wantKept []int
+		// wantNew reports whether a successor is expected to be published.
+		wantNew bool
+	}{
+		{
+			name:       "current key keeps signing",
+			offsets:    []time.Duration{-time.Hour},
+			wantSigner: 0,
+			wantKept:   []int{0},
+		},
+		{
+			name:       "successor not published too early",
+			offsets:    []time.Duration{-24*time.Hour + keyPublishLead + time.Minute},
+			wantSigner: 0,
+			wantKept:   []int{0},
+		},
+		{
+			name:       "successor published ahead of rotation",
+			offsets:    []time.Duration{-24*time.Hour + 30*time.Second},
+			wantSigner: 0,
+			wantKept:   []int{0},
+			wantNew:    true,
+		},
+		{
+			name:       "published successor does not sign yet",
+			offsets:    []time.Duration{30 * time.Second, -24 * time.Hour},
+			wantSigner: 1,
+			wantKept:   []int{0, 1},
+		},
+		{
+			name:       "successor takes over when due",
+			offsets:    []time.Duration{-time.Second, -24 * time.Hour},
+			wantSigner: 0,
+			wantKept:   []int{0, 1},
+		},
+		{
+			name:       "previous key retained while its tokens may be valid",
+			offsets:    []time.Duration{-10 * time.Minute, -48 * time.Hour},
+			wantSigner: 0,
+			wantKept:   []int{0, 1},
+		},
+		{
+			name:       "previous key removed once its tokens have expired",
+			offsets:    []time.Duration{-20 * time.Minute, -48 * time.Hour, -72 * time.Hour},
+			wantSigner: 0,
+			wantKept:   []int{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := newTestKeyManager(t, dir)
+			for _, key := range m.keys {
+				if err := os.Remove(filepath.Join(dir, key.id+keyFileExt)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ids := make([]string, len(tt.offsets))
+			for i, offset := range tt.offsets {
+				ids[i] = writeKey(t, m, offset)
+			}
+
+			if err := m.refresh(); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+
+			if got := m.signingKey(); got == nil || got.id != ids[tt.wantSigner] {
+				t.Errorf("signing key = %v, want %s", got, ids[tt.wantSigner])
+			}
+
+			want := make([]string, 0, len(tt.wantKept))
+			for _, i := range tt.wantKept {
+				want = append(want, ids[i])
+			}
+			got := jwksKeyIDs(m)
+			wantLen := len(want)
+			if tt.wantNew {
+				wantLen++
+			}
+			if len(got) != wantLen {
+				t.Fatalf("published keys = %v, want %d keys including %v", got, wantLen, want)
+			}
+			for _, id := range want {
+				if i := sort.SearchStrings(got, id); i == len(got) || got[i] != id {
+					t.Errorf("published keys = %v, missing %s", got, id)
+				}
+			}
+
+			for i, id := range ids {
+				_, err := os.Stat(filepath.Join(dir, id+keyFileExt))
+				kept := false
+				for _, k := range tt.wantKept {
+					kept = kept || k == i
+				}
+				if kept && err != nil {
+					t.Errorf("key %d removed from disk: %v", i, err)
+				}
+				if !kept && !os.IsNotExist(err) {
+					t.Errorf("key %d still on disk", i)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTokenLoadsUnknownKey(t *testing.T) {
+	dir := t.TempDir()
+	verifier := newTestKeyManager(t, dir)
+	signer := newTestKeyManager(t, dir)
+
+	takeOver(t, signer)
+	token, err := signer.GenerateToken(7, "listener", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	claims, err := verifier.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != 7 {
+		t.Errorf("UserID = %d, want 7", claims.UserID)
+	}
+}
+
+func TestValidateTokenRateLimitsReloads(t *testing.T) {
+	dir := t.TempDir()
+	verifier := newTestKeyManager(t, dir)
+	signer := newTestKeyManager(t, dir)
+
+	verifier.lastUnknownRefresh = time.Now()
+
+	takeOver(t, signer)
+	token, err := signer.GenerateToken(7, "listener", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	if _, err := verifier.ValidateToken(token); err == nil {
+		t.Error("ValidateToken accepted a key it was not allowed to reload yet")
+	}
+
+	verifier.lastUnknownRefresh = time.Now().Add(-unknownKeyRefreshInterval)
+	if _, err := verifier.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken: %v", err)
+	}
+}
+
+func TestRotatePublishesAhead(t *testing.T) {
+	m := newTestKeyManager(t, t.TempDir())
+	current := m.signingKey()
+
+	if err := m.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	if got := m.signingKey(); got == nil || got.id != current.id {
+		t.Errorf("signing key = %v right after Rotate, want %s until the new key is due", got, current.id)
+	}
+	if got := jwksKeyIDs(m); len(got) != 2 {
+		t.Fatalf("published keys = %v, want the current key and its successor", got)
+	}
+
+	// Verifiers that fetched the JWKS just before the successor was
+	// published must have let their copy expire by the time it signs.
+	successor := m.keys[0]
+	if lead := time.Until(successor.created); lead < JWKSMaxAge {
+		t.Errorf("successor takes over in %s, want at least the JWKS max-age of %s", lead, JWKSMaxAge)
+	}
+}
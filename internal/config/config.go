@@ -5,14 +5,23 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
 type Config struct {
-	DB     DBConfig     `yaml:"db"`
-	Server ServerConfig `yaml:"server"`
-	Logger Logger       `yaml:"logger"`
+	DB      DBConfig      `yaml:"db"`
+	Server  ServerConfig  `yaml:"server"`
+	Logger  Logger        `yaml:"logger"`
+	Storage StorageConfig `yaml:"storage"`
+	Auth    AuthConfig    `yaml:"auth"`
+	Mail    MailConfig    `yaml:"mail"`
 }
 
 type DBConfig struct {
@@ -25,7 +34,54 @@ type DBConfig struct {
 }
 
 type ServerConfig struct {
-	Port string `yaml:"port"`
+	Port          string `yaml:"port"`
+	PublicURL     string `yaml:"public_url"`
+	MaxUploadSize int64  `yaml:"max_upload_size"`
+}
+
+type StorageConfig struct {
+	Driver string             `yaml:"driver"`
+	Local  LocalStorageConfig `yaml:"local"`
+	S3     S3StorageConfig    `yaml:"s3"`
+}
+
+type LocalStorageConfig struct {
+	Path string `yaml:"path"`
+}
+
+type S3StorageConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	PathStyle bool   `yaml:"path_style"`
+}
+
+type AuthConfig struct {
+	AccessTokenTTL      time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL     time.Duration `yaml:"refresh_token_ttl"`
+	KeysDir             string        `yaml:"keys_dir"`
+	SigningAlgorithm    string        `yaml:"signing_algorithm"`
+	KeyRotationInterval time.Duration `yaml:"key_rotation_interval"`
+}
+
+type MailConfig struct {
+	Driver string         `yaml:"driver"`
+	From   string         `yaml:"from"`
+	File   FileMailConfig `yaml:"file"`
+	SMTP   SMTPConfig     `yaml:"smtp"`
+}
+
+type FileMailConfig struct {
+	Path string `yaml:"path"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
 }
 
 type Logger struct {
@@ -63,5 +119,29 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
 
+	if err := config.Auth.applyDefaults(); err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+
 	return &config, nil
 }
+
+// applyDefaults fills in the token lifetimes a config leaves out, since a
+// zero TTL would issue tokens that have already expired.
+func (c *AuthConfig) applyDefaults() error {
+	if c.AccessTokenTTL < 0 {
+		return fmt.Errorf("access_token_ttl must be positive, got %s", c.AccessTokenTTL)
+	}
+	if c.RefreshTokenTTL < 0 {
+		return fmt.Errorf("refresh_token_ttl must be positive, got %s", c.RefreshTokenTTL)
+	}
+
+	if c.AccessTokenTTL == 0 {
+		c.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if c.RefreshTokenTTL == 0 {
+		c.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+// Error kinds. Every error a service wants clients to see matches exactly
+// one of them with errors.Is; anything else is an internal failure.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrValidation   = errors.New("validation failed")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+
+	// ErrPreconditionFailed reports that a resource was changed since the
+	// version the client based its request on.
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	// ErrTooManyRequests reports that a client must wait before trying
+	// again.
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+// FieldError describes a problem with a single request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error of a given kind whose message is safe to return
+// to clients.
+type Error struct {
+	Kind    error
+	Message string
+	Fields  []FieldError
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func New(kind error, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+func NotFound(resource string) *Error {
+	return New(ErrNotFound, resource+" not found")
+}
+
+func Forbidden(message string) *Error {
+	return New(ErrForbidden, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(ErrUnauthorized, message)
+}
+
+// Conflict reports that field clashes with an existing resource.
+func Conflict(field string) *Error {
+	return &Error{
+		Kind:    ErrConflict,
+		Message: field + " is already taken",
+		Fields:  []FieldError{{Field: field, Message: "already exists"}},
+	}
+}
+
+// Invalid reports a single invalid field.
+func Invalid(field, message string) *Error {
+	return &Error{
+		Kind:    ErrValidation,
+		Message: field + " " + message,
+		Fields:  []FieldError{{Field: field, Message: message}},
+	}
+}
+
+// Validation collects field errors. The zero value is ready to use.
+type Validation struct {
+	fields []FieldError
+}
+
+func (v *Validation) Add(field, message string) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: message})
+}
+
+// Err returns a validation error listing every field added so far, or nil
+// if there were none.
+func (v *Validation) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(v.fields))
+	for _, f := range v.fields {
+		messages = append(messages, f.Field+" "+f.Message)
+	}
+
+	return &Error{
+		Kind:    ErrValidation,
+		Message: strings.Join(messages, "; "),
+		Fields:  v.fields,
+	}
+}
@@ -0,0 +1,13 @@
+package domain
+
+// AnyVersion matches every version of a resource, like "If-Match: *".
+const AnyVersion = 0
+
+// CheckVersion fails with ErrPreconditionFailed if a client based its change
+// on another version of resource than the current one.
+func CheckVersion(resource string, current, expected int) error {
+	if expected != AnyVersion && expected != current {
+		return New(ErrPreconditionFailed, resource+" has been modified by another request")
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package album
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/http/paging"
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/middleware"
+	"music-hosting/internal/models"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Service interface {
+	CreateAlbum(ctx context.Context, album *models.Album) error
+	GetAlbum(ctx context.Context, id int) (*models.Album, error)
+	GetAlbums(ctx context.Context, artistID int, title string, page *models.PageRequest) (*models.Page[*models.Album], error)
+	UpdateAlbum(ctx context.Context, principal *models.Principal, album *models.Album) error
+	DeleteAlbum(ctx context.Context, principal *models.Principal, id int) error
+	SetAlbumCover(ctx context.Context, principal *models.Principal, id int, image io.Reader) (*models.Album, error)
+	OpenAlbumCover(ctx context.Context, album *models.Album) (io.ReadSeekCloser, time.Time, error)
+}
+
+type Handler struct {
+	service Service
+	logger  *slog.Logger
+}
+
+func NewHandler(service Service, logger *slog.Logger) *Handler {
+	return &Handler{service: service, logger: logger}
+}
+
+func (h *Handler) CreateAlbum() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.AlbumRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		album, err := newAlbum(&request)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+		album.OwnerID = principal.UserID
+
+		if err := h.service.CreateAlbum(c.Request.Context(), album); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, newAlbumResponse(album))
+	}
+}
+
+func (h *Handler) GetAlbum() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid album ID")
+			return
+		}
+
+		album, err := h.service.GetAlbum(c.Request.Context(), id)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newAlbumResponse(album))
+	}
+}
+
+func (h *Handler) GetAlbums() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var artistID int
+		var err error
+
+		if artistIDQuery := c.Query("artistID"); artistIDQuery != "" {
+			artistID, err = strconv.Atoi(artistIDQuery)
+			if err != nil {
+				problem.BadRequest(c, "Invalid artist ID")
+				return
+			}
+		}
+
+		page, ok := paging.Request(c)
+		if !ok {
+			return
+		}
+
+		albums, err := h.service.GetAlbums(c.Request.Context(), artistID, c.Query("title"), page)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		paging.Respond(c, albums, newAlbumResponse)
+	}
+}
+
+// GetArtistAlbums lists the albums of an artist, newest release first.
+func (h *Handler) GetArtistAlbums() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		artistID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid artist ID")
+			return
+		}
+
+		page, ok := paging.Request(c)
+		if !ok {
+			return
+		}
+
+		albums, err := h.service.GetAlbums(c.Request.Context(), artistID, "", page)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		paging.Respond(c, albums, newAlbumResponse)
+	}
+}
+
+func (h *Handler) UpdateAlbum() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid album ID")
+			return
+		}
+
+		var request models.AlbumRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		album, err := newAlbum(&request)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+		album.ID = id
+
+		if err := h.service.UpdateAlbum(c.Request.Context(), principal, album); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newAlbumResponse(album))
+	}
+}
+
+func (h *Handler) DeleteAlbum() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid album ID")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		if err := h.service.DeleteAlbum(c.Request.Context(), principal, id); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// SetAlbumCover replaces the cover art of an album with the image uploaded
+// in the "file" form field.
+func (h *Handler) SetAlbumCover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid album ID")
+			return
+		}
+
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				problem.Respond(c, http.StatusRequestEntityTooLarge, "File is too large")
+				return
+			}
+
+			problem.BadRequest(c, "Image file is required")
+			return
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			problem.BadRequest(c, "Invalid image file")
+			return
+		}
+		defer file.Close()
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		album, err := h.service.SetAlbumCover(c.Request.Context(), principal, id, file)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newAlbumResponse(album))
+	}
+}
+
+func (h *Handler) GetAlbumCover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid album ID")
+			return
+		}
+
+		album, err := h.service.GetAlbum(c.Request.Context(), id)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		file, modTime, err := h.service.OpenAlbumCover(c.Request.Context(), album)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+		defer file.Close()
+
+		if ct := mime.TypeByExtension(path.Ext(album.CoverKey)); ct != "" {
+			c.Header("Content-Type", ct)
+		}
+
+		http.ServeContent(c.Writer, c.Request, "", modTime, file)
+	}
+}
+
+// newAlbum converts a request body, parsing its release date.
+func newAlbum(request *models.AlbumRequest) (*models.Album, error) {
+	album := &models.Album{
+		Title:    request.Title,
+		ArtistID: request.ArtistID,
+	}
+
+	if request.ReleaseDate != "" {
+		date, err := time.Parse(models.ReleaseDateLayout, request.ReleaseDate)
+		if err != nil {
+			return nil, domain.Invalid("release_date", "must be a date in YYYY-MM-DD format")
+		}
+		album.ReleaseDate = &date
+	}
+
+	return album, nil
+}
+
+func newAlbumResponse(album *models.Album) models.AlbumResponse {
+	response := models.AlbumResponse{
+		ID:         album.ID,
+		Title:      album.Title,
+		ArtistID:   album.ArtistID,
+		ArtistName: album.ArtistName,
+		OwnerID:    album.OwnerID,
+		CreatedAt:  album.CreatedAt,
+		UpdatedAt:  album.UpdatedAt,
+	}
+
+	if album.ReleaseDate != nil {
+		response.ReleaseDate = album.ReleaseDate.Format(models.ReleaseDateLayout)
+	}
+
+	if album.CoverKey != "" {
+		response.CoverURL = fmt.Sprintf("/api/v1/albums/%d/cover", album.ID)
+	}
+
+	return response
+}
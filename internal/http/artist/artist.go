@@ -0,0 +1,161 @@
+package artist
+
+import (
+	"context"
+	"log/slog"
+	"music-hosting/internal/http/paging"
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/middleware"
+	"music-hosting/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Service interface {
+	CreateArtist(ctx context.Context, artist *models.Artist) error
+	GetArtist(ctx context.Context, id int) (*models.Artist, error)
+	GetArtists(ctx context.Context, name string, page *models.PageRequest) (*models.Page[*models.Artist], error)
+	UpdateArtist(ctx context.Context, principal *models.Principal, artist *models.Artist) error
+	DeleteArtist(ctx context.Context, principal *models.Principal, id int) error
+}
+
+type Handler struct {
+	service Service
+	logger  *slog.Logger
+}
+
+func NewHandler(service Service, logger *slog.Logger) *Handler {
+	return &Handler{service: service, logger: logger}
+}
+
+func (h *Handler) CreateArtist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.ArtistRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		artist := models.Artist{
+			Name:    request.Name,
+			OwnerID: principal.UserID,
+		}
+
+		if err := h.service.CreateArtist(c.Request.Context(), &artist); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, newArtistResponse(&artist))
+	}
+}
+
+func (h *Handler) GetArtist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid artist ID")
+			return
+		}
+
+		artist, err := h.service.GetArtist(c.Request.Context(), id)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newArtistResponse(artist))
+	}
+}
+
+func (h *Handler) GetArtists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, ok := paging.Request(c)
+		if !ok {
+			return
+		}
+
+		artists, err := h.service.GetArtists(c.Request.Context(), c.Query("name"), page)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		paging.Respond(c, artists, newArtistResponse)
+	}
+}
+
+func (h *Handler) UpdateArtist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid artist ID")
+			return
+		}
+
+		var request models.ArtistRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		artist := models.Artist{
+			ID:   id,
+			Name: request.Name,
+		}
+
+		if err := h.service.UpdateArtist(c.Request.Context(), principal, &artist); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newArtistResponse(&artist))
+	}
+}
+
+func (h *Handler) DeleteArtist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid artist ID")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		if err := h.service.DeleteArtist(c.Request.Context(), principal, id); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func newArtistResponse(artist *models.Artist) models.ArtistResponse {
+	return models.ArtistResponse{
+		ID:        artist.ID,
+		Name:      artist.Name,
+		OwnerID:   artist.OwnerID,
+		CreatedAt: artist.CreatedAt,
+		UpdatedAt: artist.UpdatedAt,
+	}
+}
@@ -0,0 +1,30 @@
+package jwks
+
+import (
+	"music-hosting/internal/auth"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeySet interface {
+	JWKS() *auth.JWKS
+}
+
+type Handler struct {
+	keys KeySet
+}
+
+func NewHandler(keys KeySet) *Handler {
+	return &Handler{keys: keys}
+}
+
+func (h *Handler) GetJWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// New keys are published long enough ahead of use for a cached
+		// copy to expire first.
+		c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(auth.JWKSMaxAge.Seconds())))
+		c.JSON(http.StatusOK, h.keys.JWKS())
+	}
+}
@@ -0,0 +1,33 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"music-hosting/internal/http/problem"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ContentType = "application/merge-patch+json"
+
+// Bind decodes a JSON Merge Patch (RFC 7396) request body into v, whose
+// members should be models.Field values. Plain application/json is accepted
+// too. Members v does not declare are rejected, so only whitelisted fields
+// can be patched. On failure Bind writes a problem response and returns
+// false.
+func Bind(c *gin.Context, v any) bool {
+	if ct := c.ContentType(); ct != ContentType && ct != gin.MIMEJSON {
+		c.Header("Accept-Patch", ContentType)
+		problem.Respond(c, http.StatusUnsupportedMediaType, "Content-Type must be "+ContentType)
+		return false
+	}
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		problem.BadRequest(c, "Invalid merge patch document: "+err.Error())
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package paging
+
+import (
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+// Request reads the cursor, limit and total query parameters of a list
+// request. Limits above 100 are lowered to 100. Malformed parameters are
+// answered with 400, and Request reports whether the request may go on.
+func Request(c *gin.Context) (*models.PageRequest, bool) {
+	page := &models.PageRequest{Cursor: c.Query("cursor"), Limit: defaultLimit}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			problem.BadRequest(c, "Invalid limit")
+			return nil, false
+		}
+		page.Limit = min(limit, maxLimit)
+	}
+
+	if value := c.Query("total"); value != "" {
+		total, err := strconv.ParseBool(value)
+		if err != nil {
+			problem.BadRequest(c, "Invalid total")
+			return nil, false
+		}
+		page.Total = total
+	}
+
+	return page, true
+}
+
+// Respond writes page in the list envelope, converting each item with
+// convert. The next and prev links repeat the request with the cursor of
+// the neighbouring page.
+func Respond[T, R any](c *gin.Context, page *models.Page[T], convert func(T) R) {
+	response := models.ListResponse[R]{
+		Items: []R{},
+		Next:  link(c, page.Next),
+		Prev:  link(c, page.Prev),
+		Total: page.Total,
+	}
+	for _, item := range page.Items {
+		response.Items = append(response.Items, convert(item))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func link(c *gin.Context, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set("cursor", cursor)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
@@ -3,6 +3,12 @@ package playlist
 import (
 	"context"
 	"log/slog"
+	"music-hosting/internal/http/mergepatch"
+	"music-hosting/internal/http/paging"
+	"music-hosting/internal/http/precondition"
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/http/track"
+	"music-hosting/internal/middleware"
 	"music-hosting/internal/models"
 	"net/http"
 	"strconv"
@@ -11,11 +17,15 @@ import (
 )
 
 type Service interface {
-	CreatePlaylist(ctx context.Context, playlist *models.Playlist) error
+	CreatePlaylist(ctx context.Context, playlist *models.Playlist, trackIDs []int) (*models.Playlist, error)
 	GetPlaylistByID(ctx context.Context, id int) (*models.Playlist, error)
-	GetPlaylists(ctx context.Context, name string, userID int) ([]*models.Playlist, error)
-	UpdatePlaylist(ctx context.Context, playlist *models.Playlist, trackIDs []int) error
-	DeletePlaylist(ctx context.Context, id int) error
+	GetPlaylists(ctx context.Context, name string, userID int, page *models.PageRequest) (*models.Page[*models.Playlist], error)
+	UpdatePlaylist(ctx context.Context, principal *models.Principal, playlist *models.Playlist, trackIDs []int, version int) (*models.Playlist, error)
+	PatchPlaylist(ctx context.Context, principal *models.Principal, id, version int, patch *models.PlaylistPatch) (*models.Playlist, error)
+	DeletePlaylist(ctx context.Context, principal *models.Principal, id, version int) error
+	InsertPlaylistTracks(ctx context.Context, principal *models.Principal, id, version int, trackIDs []int, position *int) (*models.Playlist, error)
+	MovePlaylistTracks(ctx context.Context, principal *models.Principal, id, version, rangeStart, rangeLength, insertBefore int) (*models.Playlist, error)
+	RemovePlaylistEntry(ctx context.Context, principal *models.Principal, id, version, entryID int) (*models.Playlist, error)
 }
 
 type Handler struct {
@@ -31,15 +41,13 @@ func (h *Handler) CreatePlaylist() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var playlist models.CreatePlaylistRequest
 		if err := c.ShouldBindJSON(&playlist); err != nil {
-			h.logger.Error("Error parsing request body", slog.Any("Error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Error parsing request body"})
+			problem.BadRequest(c, "Error parsing request body")
 			return
 		}
 
 		userID, exists := c.Get("userID")
 		if !exists {
-			h.logger.Error("User ID not found in context")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
 			return
 		}
 
@@ -48,14 +56,15 @@ func (h *Handler) CreatePlaylist() gin.HandlerFunc {
 			UserID: userID.(int),
 		}
 
-		err := h.service.CreatePlaylist(c.Request.Context(), &playlistServ)
+		created, err := h.service.CreatePlaylist(c.Request.Context(), &playlistServ, playlist.TrackIDs)
 		if err != nil {
-			h.logger.Error("Error creating playlist", slog.Any("Error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating playlist"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		c.JSON(http.StatusCreated, nil)
+		c.Header("Location", c.Request.URL.Path+"/"+strconv.Itoa(created.ID))
+		precondition.SetETag(c, created.Version)
+		c.JSON(http.StatusCreated, newPlaylistResponse(created))
 	}
 }
 
@@ -64,41 +73,18 @@ func (h *Handler) GetPlaylistByID() gin.HandlerFunc {
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			h.logger.Error("Invalid playlist ID", slog.Any("Error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist ID"})
+			problem.BadRequest(c, "Invalid playlist ID")
 			return
 		}
 
 		playlist, err := h.service.GetPlaylistByID(c.Request.Context(), id)
 		if err != nil {
-			h.logger.Error("Error getting playlist", slog.Any("Error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting playlist"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		if playlist == nil {
-			h.logger.Info("Playlist not found", slog.Int("playlistID", id))
-			c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
-			return
-		}
-
-		userID, exists := c.Get("userID")
-		if !exists {
-			h.logger.Error("User ID not found in context")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
-			return
-		}
-
-		playlistResponse := models.PlaylistResponse{
-			ID:        playlist.ID,
-			Name:      playlist.Name,
-			UserID:    userID.(int),
-			Tracks:    playlist.Tracks,
-			CreatedAt: playlist.CreatedAt,
-			UpdatedAt: playlist.UpdatedAt,
-		}
-
-		c.JSON(http.StatusOK, playlistResponse)
+		precondition.SetETag(c, playlist.Version)
+		c.JSON(http.StatusOK, newPlaylistResponse(playlist))
 	}
 }
 
@@ -113,33 +99,48 @@ func (h *Handler) GetPlaylists() gin.HandlerFunc {
 		if userIDQuery != "" {
 			userID, err = strconv.Atoi(userIDQuery)
 			if err != nil {
-				h.logger.Error("Invalid user ID", slog.Any("Error", err))
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+				problem.BadRequest(c, "Invalid user ID")
 				return
 			}
 		}
 
-		playlists, err := h.service.GetPlaylists(c.Request.Context(), name, userID)
+		page, ok := paging.Request(c)
+		if !ok {
+			return
+		}
+
+		playlists, err := h.service.GetPlaylists(c.Request.Context(), name, userID, page)
 		if err != nil {
-			h.logger.Error("Error getting playlists", slog.Any("Error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting playlists"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		var playlistsResponse []models.PlaylistResponse
-		for _, playlist := range playlists {
-			playlistResponse := models.PlaylistResponse{
-				ID:        playlist.ID,
-				Name:      playlist.Name,
-				UserID:    playlist.UserID,
-				Tracks:    playlist.Tracks,
-				CreatedAt: playlist.CreatedAt,
-				UpdatedAt: playlist.UpdatedAt,
-			}
-			playlistsResponse = append(playlistsResponse, playlistResponse)
+		paging.Respond(c, playlists, newPlaylistResponse)
+	}
+}
+
+// GetMyPlaylists lists the playlists of the current user, optionally
+// filtered by name.
+func (h *Handler) GetMyPlaylists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
 		}
 
-		c.JSON(http.StatusOK, playlistsResponse)
+		page, ok := paging.Request(c)
+		if !ok {
+			return
+		}
+
+		playlists, err := h.service.GetPlaylists(c.Request.Context(), c.Query("name"), principal.UserID, page)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		paging.Respond(c, playlists, newPlaylistResponse)
 	}
 }
 
@@ -148,58 +149,244 @@ func (h *Handler) UpdatePlaylist() gin.HandlerFunc {
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			h.logger.Error("Invalid playlist ID", slog.Any("Error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist ID"})
+			problem.BadRequest(c, "Invalid playlist ID")
+			return
+		}
+
+		version, ok := precondition.IfMatch(c)
+		if !ok {
 			return
 		}
 
 		var playlistRequest models.CreatePlaylistRequest
 		if err := c.ShouldBindJSON(&playlistRequest); err != nil {
-			h.logger.Error("Error parsing request body", slog.Any("Error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			problem.BadRequest(c, "Invalid request body")
 			return
 		}
 
-		userID, exists := c.Get("userID")
+		principal, exists := middleware.CurrentUser(c)
 		if !exists {
-			h.logger.Error("User ID not found in context")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
 			return
 		}
 
 		playlist := models.Playlist{
-			ID:     id,
-			Name:   playlistRequest.Name,
-			UserID: userID.(int),
+			ID:   id,
+			Name: playlistRequest.Name,
 		}
 
-		err = h.service.UpdatePlaylist(c.Request.Context(), &playlist, playlistRequest.TrackIDs)
+		updated, err := h.service.UpdatePlaylist(c.Request.Context(), principal, &playlist, playlistRequest.TrackIDs, version)
 		if err != nil {
-			h.logger.Error("Error updating playlist", slog.Any("Error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update playlist"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, nil)
+		precondition.SetETag(c, updated.Version)
+		c.JSON(http.StatusOK, newPlaylistResponse(updated))
+	}
+}
+
+func (h *Handler) PatchPlaylist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid playlist ID")
+			return
+		}
+
+		version, ok := precondition.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		var patch models.PlaylistPatch
+		if !mergepatch.Bind(c, &patch) {
+			return
+		}
+
+		playlist, err := h.service.PatchPlaylist(c.Request.Context(), principal, id, version, &patch)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		precondition.SetETag(c, playlist.Version)
+		c.JSON(http.StatusOK, newPlaylistResponse(playlist))
 	}
 }
+
 func (h *Handler) DeletePlaylist() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			h.logger.Error("Invalid playlist ID", slog.Any("Error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist ID"})
+			problem.BadRequest(c, "Invalid playlist ID")
 			return
 		}
 
-		err = h.service.DeletePlaylist(c.Request.Context(), id)
+		version, ok := precondition.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		err = h.service.DeletePlaylist(c.Request.Context(), principal, id, version)
 		if err != nil {
-			h.logger.Error("Error deleting playlist", slog.Any("Error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting playlist"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, nil)
 	}
 }
+
+// InsertPlaylistTracks adds tracks at a given position of a playlist, or
+// at its end.
+func (h *Handler) InsertPlaylistTracks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid playlist ID")
+			return
+		}
+
+		version, ok := precondition.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		var request models.InsertPlaylistTracksRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		playlist, err := h.service.InsertPlaylistTracks(c.Request.Context(), principal, id, version, request.TrackIDs, request.Position)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		precondition.SetETag(c, playlist.Version)
+		c.JSON(http.StatusOK, newPlaylistResponse(playlist))
+	}
+}
+
+// MovePlaylistTracks moves a range of entries to another position.
+func (h *Handler) MovePlaylistTracks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid playlist ID")
+			return
+		}
+
+		version, ok := precondition.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		var request models.MovePlaylistTracksRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		playlist, err := h.service.MovePlaylistTracks(
+			c.Request.Context(),
+			principal,
+			id,
+			version,
+			request.RangeStart,
+			request.RangeLength,
+			request.InsertBefore,
+		)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		precondition.SetETag(c, playlist.Version)
+		c.JSON(http.StatusOK, newPlaylistResponse(playlist))
+	}
+}
+
+// RemovePlaylistEntry removes one entry, identified by its entry ID rather
+// than its track ID, from a playlist.
+func (h *Handler) RemovePlaylistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid playlist ID")
+			return
+		}
+
+		entryID, err := strconv.Atoi(c.Param("entryID"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid entry ID")
+			return
+		}
+
+		version, ok := precondition.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		playlist, err := h.service.RemovePlaylistEntry(c.Request.Context(), principal, id, version, entryID)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		precondition.SetETag(c, playlist.Version)
+		c.JSON(http.StatusOK, newPlaylistResponse(playlist))
+	}
+}
+
+func newPlaylistResponse(playlist *models.Playlist) models.PlaylistResponse {
+	tracks := []models.TrackResponse{}
+	for _, t := range playlist.Tracks {
+		tracks = append(tracks, track.NewTrackResponse(t))
+	}
+
+	return models.PlaylistResponse{
+		ID:              playlist.ID,
+		Name:            playlist.Name,
+		UserID:          playlist.UserID,
+		Tracks:          tracks,
+		Entries:         playlist.Entries,
+		TotalDurationMs: playlist.TotalDurationMs,
+		CreatedAt:       playlist.CreatedAt,
+		UpdatedAt:       playlist.UpdatedAt,
+		Version:         playlist.Version,
+	}
+}
@@ -0,0 +1,50 @@
+package precondition
+
+import (
+	"music-hosting/internal/domain"
+	"music-hosting/internal/http/problem"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag formats a resource version as a strong entity tag.
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// SetETag sets the ETag header to the given resource version.
+func SetETag(c *gin.Context, version int) {
+	c.Header("ETag", ETag(version))
+}
+
+// IfMatch returns the version named by the If-Match header, or
+// domain.AnyVersion for "*". Requests without the header are answered with
+// 428, and tags that cannot match a version, such as weak or malformed ones,
+// with 412. IfMatch reports whether the request may go on.
+func IfMatch(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		problem.Respond(c, http.StatusPreconditionRequired, "If-Match header is required")
+		return 0, false
+	}
+
+	if header == "*" {
+		return domain.AnyVersion, true
+	}
+
+	if len(header) < 2 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		problem.Respond(c, http.StatusPreconditionFailed, "If-Match must be the ETag of the current version")
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(header[1 : len(header)-1])
+	if err != nil || version <= 0 {
+		problem.Respond(c, http.StatusPreconditionFailed, "If-Match must be the ETag of the current version")
+		return 0, false
+	}
+
+	return version, true
+}
@@ -0,0 +1,57 @@
+package precondition
+
+import (
+	"music-hosting/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		header      string
+		wantVersion int
+		wantOK      bool
+		wantStatus  int
+	}{
+		{name: "missing", wantStatus: http.StatusPreconditionRequired},
+		{name: "blank", header: "  ", wantStatus: http.StatusPreconditionRequired},
+		{name: "any", header: "*", wantVersion: domain.AnyVersion, wantOK: true},
+		{name: "version", header: `"3"`, wantVersion: 3, wantOK: true},
+		{name: "surrounding space", header: ` "3" `, wantVersion: 3, wantOK: true},
+		{name: "weak", header: `W/"3"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "unquoted", header: "3", wantStatus: http.StatusPreconditionFailed},
+		{name: "lone quote", header: `"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "not a number", header: `"abc"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "zero", header: `"0"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "negative", header: `"-1"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "several tags", header: `"3", "4"`, wantStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/api/v1/tracks/1", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("If-Match", tt.header)
+			}
+
+			version, ok := IfMatch(c)
+			if ok != tt.wantOK || version != tt.wantVersion {
+				t.Errorf("IfMatch() = %d, %v, want %d, %v", version, ok, tt.wantVersion, tt.wantOK)
+			}
+			if !tt.wantOK && w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantOK && c.Writer.Written() {
+				t.Errorf("IfMatch() wrote a %d response to an acceptable request", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package problem
+
+import (
+	"errors"
+	"log/slog"
+	"music-hosting/internal/domain"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Errors   []domain.FieldError `json:"errors,omitempty"`
+}
+
+var kindStatus = []struct {
+	kind   error
+	status int
+}{
+	{domain.ErrNotFound, http.StatusNotFound},
+	{domain.ErrValidation, http.StatusUnprocessableEntity},
+	{domain.ErrUnauthorized, http.StatusUnauthorized},
+	{domain.ErrForbidden, http.StatusForbidden},
+	{domain.ErrConflict, http.StatusConflict},
+	{domain.ErrPreconditionFailed, http.StatusPreconditionFailed},
+	{domain.ErrTooManyRequests, http.StatusTooManyRequests},
+}
+
+// Error writes err as a problem response and aborts the request. Domain
+// errors are mapped to their status code and message; anything else is
+// logged and reported as a 500 without details.
+func Error(c *gin.Context, logger *slog.Logger, err error) {
+	for _, ks := range kindStatus {
+		if !errors.Is(err, ks.kind) {
+			continue
+		}
+
+		p := newProblem(c, ks.status, err.Error())
+
+		var domainErr *domain.Error
+		if errors.As(err, &domainErr) {
+			p.Detail = domainErr.Message
+			p.Errors = domainErr.Fields
+		}
+
+		write(c, p)
+		return
+	}
+
+	logger.Error(
+		"Request failed",
+		slog.String("method", c.Request.Method),
+		slog.String("path", c.Request.URL.Path),
+		slog.Any("error", err),
+	)
+	write(c, newProblem(c, http.StatusInternalServerError, ""))
+}
+
+// Respond writes a problem with the given status and detail and aborts the
+// request. It is meant for failures detected by handlers and middleware
+// themselves, such as malformed input.
+func Respond(c *gin.Context, status int, detail string) {
+	write(c, newProblem(c, status, detail))
+}
+
+// BadRequest reports a request that could not be parsed.
+func BadRequest(c *gin.Context, detail string) {
+	Respond(c, http.StatusBadRequest, detail)
+}
+
+func newProblem(c *gin.Context, status int, detail string) *Problem {
+	return &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request.URL.Path,
+	}
+}
+
+func write(c *gin.Context, p *Problem) {
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
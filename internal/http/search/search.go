@@ -0,0 +1,160 @@
+package search
+
+import (
+	"context"
+	"log/slog"
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Service interface {
+	Search(ctx context.Context, text string, types []string, limit int) (*models.SearchResults, error)
+	Suggest(ctx context.Context, prefix string, limit int) (*models.Suggestions, error)
+}
+
+type Handler struct {
+	service Service
+	logger  *slog.Logger
+}
+
+func NewHandler(service Service, logger *slog.Logger) *Handler {
+	return &Handler{service: service, logger: logger}
+}
+
+// Search answers GET /search?q=...&type=tracks,artists&limit=5 with one
+// section of ranked hits per requested type.
+func (h *Handler) Search() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 0
+		if value := c.Query("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				problem.BadRequest(c, "Invalid limit")
+				return
+			}
+		}
+
+		var types []string
+		for _, t := range strings.Split(c.Query("type"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+
+		results, err := h.service.Search(c.Request.Context(), c.Query("q"), types, limit)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newSearchResponse(results))
+	}
+}
+
+// Suggest answers GET /search/suggest?q=...&limit=5 with the names that
+// complete q, for search-as-you-type.
+func (h *Handler) Suggest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 0
+		if value := c.Query("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				problem.BadRequest(c, "Invalid limit")
+				return
+			}
+		}
+
+		suggestions, err := h.service.Suggest(c.Request.Context(), c.Query("q"), limit)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, models.SuggestResponse{
+			Tracks:    newSuggestionResponses(suggestions.Tracks),
+			Artists:   newSuggestionResponses(suggestions.Artists),
+			Playlists: newSuggestionResponses(suggestions.Playlists),
+		})
+	}
+}
+
+func newSuggestionResponses(suggestions []*models.Suggestion) []models.SuggestionResponse {
+	responses := []models.SuggestionResponse{}
+	for _, suggestion := range suggestions {
+		responses = append(responses, models.SuggestionResponse{ID: suggestion.ID, Text: suggestion.Text})
+	}
+	return responses
+}
+
+func newSearchResponse(results *models.SearchResults) models.SearchResponse {
+	var response models.SearchResponse
+
+	if results.Tracks != nil {
+		tracks := []models.TrackHitResponse{}
+		for _, hit := range results.Tracks {
+			tracks = append(tracks, models.TrackHitResponse{
+				ID:         hit.Item.ID,
+				Name:       hit.Item.Name,
+				Artist:     hit.Item.Artist,
+				Album:      hit.Item.Album,
+				AlbumID:    hit.Item.AlbumID,
+				DurationMs: hit.Item.DurationMs,
+				Artists:    hit.Item.Artists,
+				Highlight:  hit.Highlight,
+				Score:      hit.Score,
+			})
+		}
+		response.Tracks = &tracks
+	}
+
+	if results.Artists != nil {
+		artists := []models.ArtistHitResponse{}
+		for _, hit := range results.Artists {
+			artists = append(artists, models.ArtistHitResponse{
+				ID:        hit.Item.ID,
+				Name:      hit.Item.Name,
+				Highlight: hit.Highlight,
+				Score:     hit.Score,
+			})
+		}
+		response.Artists = &artists
+	}
+
+	if results.Albums != nil {
+		albums := []models.AlbumHitResponse{}
+		for _, hit := range results.Albums {
+			albums = append(albums, models.AlbumHitResponse{
+				ID:         hit.Item.ID,
+				Title:      hit.Item.Title,
+				ArtistID:   hit.Item.ArtistID,
+				ArtistName: hit.Item.ArtistName,
+				Highlight:  hit.Highlight,
+				Score:      hit.Score,
+			})
+		}
+		response.Albums = &albums
+	}
+
+	if results.Playlists != nil {
+		playlists := []models.PlaylistHitResponse{}
+		for _, hit := range results.Playlists {
+			playlists = append(playlists, models.PlaylistHitResponse{
+				ID:        hit.Item.ID,
+				Name:      hit.Item.Name,
+				UserID:    hit.Item.UserID,
+				Highlight: hit.Highlight,
+				Score:     hit.Score,
+			})
+		}
+		response.Playlists = &playlists
+	}
+
+	return response
+}
@@ -2,20 +2,41 @@ package track
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
+	"music-hosting/internal/http/mergepatch"
+	"music-hosting/internal/http/paging"
+	"music-hosting/internal/http/precondition"
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/middleware"
 	"music-hosting/internal/models"
 	"net/http"
+	"path"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Service interface {
-	CreateTrack(ctx context.Context, track *models.Track) error
+	CreateTrack(ctx context.Context, track *models.Track) (*models.Track, error)
+	UploadTrack(ctx context.Context, track *models.Track, audio io.ReadSeeker) (*models.Track, error)
 	GetTrackByID(ctx context.Context, id int) (*models.Track, error)
-	GetTracks(ctx context.Context, name, artist string, playlistID, offset, limit int) ([]*models.Track, error)
-	UpdateTrack(ctx context.Context, track *models.Track) error
-	DeleteTrack(ctx context.Context, id int) error
+	OpenTrackAudio(ctx context.Context, track *models.Track) (io.ReadSeekCloser, time.Time, error)
+	RecordPlay(ctx context.Context, id int) error
+	OpenTrackCover(ctx context.Context, track *models.Track) (io.ReadSeekCloser, time.Time, error)
+	GetTracks(ctx context.Context, filter *models.TrackFilter, page *models.PageRequest) (*models.Page[*models.Track], error)
+	UpdateTrack(ctx context.Context, principal *models.Principal, track *models.Track, version int) (*models.Track, error)
+	PatchTrack(ctx context.Context, principal *models.Principal, id, version int, patch *models.TrackPatch) (*models.Track, error)
+	DeleteTrack(ctx context.Context, principal *models.Principal, id, version int) error
+	SetTrackArtists(ctx context.Context, principal *models.Principal, id, version int, credits []*models.Credit) (*models.Track, error)
+	SetReaction(ctx context.Context, reaction *models.Reaction) (*models.Reaction, error)
+	RemoveReaction(ctx context.Context, userID, trackID int) (*models.Reaction, error)
+	GetLikedTracks(ctx context.Context, userID int, page *models.PageRequest) (*models.Page[*models.Track], error)
+	GetUserTracks(ctx context.Context, userID int, page *models.PageRequest) (*models.Page[*models.Track], error)
 }
 
 type Handler struct {
@@ -32,30 +53,103 @@ func NewHandler(service Service, logger *slog.Logger) *Handler {
 
 func (h *Handler) CreateTrack() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if c.ContentType() == gin.MIMEMultipartPOSTForm {
+			h.uploadTrack(c)
+			return
+		}
+
 		var track models.TrackRequest
 		if err := c.ShouldBindJSON(&track); err != nil {
-			h.logger.Error("Invalid request", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			problem.BadRequest(c, "Invalid request")
+			return
+		}
+
+		userID, exists := c.Get("userID")
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
 			return
 		}
 
 		trackServ := models.Track{
-			Name:     track.Name,
-			Artist:   track.Artist,
-			URL:      track.URL,
-			Likes:    track.Likes,
-			Dislikes: track.Dislikes,
+			OwnerID:     userID.(int),
+			Name:        track.Name,
+			Artist:      track.Artist,
+			URL:         track.URL,
+			Album:       track.Album,
+			TrackNumber: track.TrackNumber,
+			Year:        track.Year,
+			Genre:       track.Genre,
+			AlbumID:     track.AlbumID,
+			DiscNumber:  track.DiscNumber,
 		}
 
-		err := h.service.CreateTrack(c.Request.Context(), &trackServ)
+		created, err := h.service.CreateTrack(c.Request.Context(), &trackServ)
 		if err != nil {
-			h.logger.Error("Error creating track", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating track"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, nil)
+		respondCreated(c, created)
+	}
+}
+
+func (h *Handler) uploadTrack(c *gin.Context) {
+	var track models.TrackRequest
+	if err := c.ShouldBind(&track); err != nil {
+		problem.BadRequest(c, "Invalid request")
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Respond(c, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+
+		problem.BadRequest(c, "Audio file is required")
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		problem.BadRequest(c, "Invalid audio file")
+		return
 	}
+	defer file.Close()
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+		return
+	}
+
+	trackServ := models.Track{
+		OwnerID:     userID.(int),
+		Name:        track.Name,
+		Artist:      track.Artist,
+		Album:       track.Album,
+		TrackNumber: track.TrackNumber,
+		Year:        track.Year,
+		Genre:       track.Genre,
+		AlbumID:     track.AlbumID,
+		DiscNumber:  track.DiscNumber,
+	}
+
+	created, err := h.service.UploadTrack(c.Request.Context(), &trackServ, file)
+	if err != nil {
+		problem.Error(c, h.logger, err)
+		return
+	}
+
+	respondCreated(c, created)
+}
+
+func respondCreated(c *gin.Context, track *models.Track) {
+	c.Header("Location", "/api/v1/tracks/"+strconv.Itoa(track.ID))
+	precondition.SetETag(c, track.Version)
+	c.JSON(http.StatusCreated, NewTrackResponse(track))
 }
 
 func (h *Handler) GetTrackByID() gin.HandlerFunc {
@@ -63,65 +157,182 @@ func (h *Handler) GetTrackByID() gin.HandlerFunc {
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			h.logger.Error("Invalid track ID", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid track ID"})
+			problem.BadRequest(c, "Invalid track ID")
 			return
 		}
 
 		track, err := h.service.GetTrackByID(c.Request.Context(), id)
 		if err != nil {
-			h.logger.Error("Error fetching track by ID", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching track by ID"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		trackResponse := models.TrackResponse{
-			ID:       track.ID,
-			Name:     track.Name,
-			Artist:   track.Artist,
-			URL:      track.URL,
-			Likes:    track.Likes,
-			Dislikes: track.Dislikes,
+		precondition.SetETag(c, track.Version)
+		c.JSON(http.StatusOK, NewTrackResponse(track))
+	}
+}
+
+func (h *Handler) StreamTrack() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		track := h.serveFile(c, "audio", h.service.OpenTrackAudio, func(track *models.Track) string {
+			return track.MimeType
+		})
+		if track == nil || !startedPlayback(c) {
+			return
 		}
 
-		c.JSON(http.StatusOK, trackResponse)
+		// The play has started once audio was sent, even if the listener
+		// goes away before the end of the stream.
+		ctx := context.WithoutCancel(c.Request.Context())
+		if err := h.service.RecordPlay(ctx, track.ID); err != nil {
+			h.logger.Warn("Failed to record play", slog.Int("trackID", track.ID), slog.Any("error", err))
+		}
 	}
 }
 
+// startedPlayback reports whether a served stream request was the start of
+// a play. HEAD requests, conditional requests answered without a body,
+// seeks within a play in progress and probes of a few bytes are not.
+func startedPlayback(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet || c.Writer.Size() <= 0 {
+		return false
+	}
+	if status := c.Writer.Status(); status != http.StatusOK && status != http.StatusPartialContent {
+		return false
+	}
+
+	rangeHeader := c.Request.Header.Get("Range")
+	return rangeHeader == "" || rangeHeader == "bytes=0-"
+}
+
+func (h *Handler) GetTrackCover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.serveFile(c, "cover", h.service.OpenTrackCover, func(track *models.Track) string {
+			return mime.TypeByExtension(path.Ext(track.CoverKey))
+		})
+	}
+}
+
+type openFunc func(ctx context.Context, track *models.Track) (io.ReadSeekCloser, time.Time, error)
+
+// serveFile answers a request for one of the files of a track and returns
+// the track, or nil if it responded with an error instead.
+func (h *Handler) serveFile(c *gin.Context, kind string, open openFunc, contentType func(*models.Track) string) *models.Track {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		problem.BadRequest(c, "Invalid track ID")
+		return nil
+	}
+
+	track, err := h.service.GetTrackByID(c.Request.Context(), id)
+	if err != nil {
+		problem.Error(c, h.logger, err)
+		return nil
+	}
+
+	file, modTime, err := open(c.Request.Context(), track)
+	if err != nil {
+		problem.Error(c, h.logger, err)
+		return nil
+	}
+	defer file.Close()
+
+	// ServeContent takes care of Range, If-Range, If-None-Match and
+	// If-Modified-Since using the headers set here.
+	if ct := contentType(track); ct != "" {
+		c.Header("Content-Type", ct)
+	}
+	if kind == "audio" && track.Checksum != "" {
+		c.Header("ETag", `"`+track.Checksum+`"`)
+	}
+
+	http.ServeContent(c.Writer, c.Request, "", modTime, file)
+	return track
+}
+
 func (h *Handler) UpdateTrack() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			h.logger.Error("Invalid track ID", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid track ID"})
+			problem.BadRequest(c, "Invalid track ID")
+			return
+		}
+
+		version, ok := precondition.IfMatch(c)
+		if !ok {
 			return
 		}
 
 		var track models.TrackRequest
 		if err := c.ShouldBindJSON(&track); err != nil {
-			h.logger.Error("Invalid request", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			problem.BadRequest(c, "Invalid request")
 			return
 		}
 
 		trackServ := models.Track{
-			ID:       id,
-			Name:     track.Name,
-			Artist:   track.Artist,
-			URL:      track.URL,
-			Likes:    track.Likes,
-			Dislikes: track.Dislikes,
+			ID:          id,
+			Name:        track.Name,
+			Artist:      track.Artist,
+			URL:         track.URL,
+			Album:       track.Album,
+			TrackNumber: track.TrackNumber,
+			Year:        track.Year,
+			Genre:       track.Genre,
+			AlbumID:     track.AlbumID,
+			DiscNumber:  track.DiscNumber,
 		}
 
-		err = h.service.UpdateTrack(c.Request.Context(), &trackServ)
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		updated, err := h.service.UpdateTrack(c.Request.Context(), principal, &trackServ, version)
 		if err != nil {
-			h.logger.Error("Error updating track", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating track"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, nil)
+		precondition.SetETag(c, updated.Version)
+		c.JSON(http.StatusOK, NewTrackResponse(updated))
+	}
+}
+
+func (h *Handler) PatchTrack() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid track ID")
+			return
+		}
+
+		version, ok := precondition.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		var patch models.TrackPatch
+		if !mergepatch.Bind(c, &patch) {
+			return
+		}
+
+		track, err := h.service.PatchTrack(c.Request.Context(), principal, id, version, &patch)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		precondition.SetETag(c, track.Version)
+		c.JSON(http.StatusOK, NewTrackResponse(track))
 	}
 }
 
@@ -130,15 +341,24 @@ func (h *Handler) DeleteTrack() gin.HandlerFunc {
 		idStr := c.Param("id")
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			h.logger.Error("Invalid track ID", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid track ID"})
+			problem.BadRequest(c, "Invalid track ID")
 			return
 		}
 
-		err = h.service.DeleteTrack(c.Request.Context(), id)
+		version, ok := precondition.IfMatch(c)
+		if !ok {
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		err = h.service.DeleteTrack(c.Request.Context(), principal, id, version)
 		if err != nil {
-			h.logger.Error("Error deleting track", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting track"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
@@ -148,58 +368,308 @@ func (h *Handler) DeleteTrack() gin.HandlerFunc {
 
 func (h *Handler) GetTracks() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		name := c.Query("name")
-		artist := c.Query("artist")
-		playlistIDStr := c.Query("playlistID")
-		offsetStr := c.DefaultQuery("offset", "0")
-		limitStr := c.DefaultQuery("limit", "10")
+		filter := models.TrackFilter{
+			Name:   c.Query("name"),
+			Artist: c.Query("artist"),
+			Genre:  c.Query("genre"),
+		}
 
-		var playlistID, offset, limit int
 		var err error
 
-		if playlistIDStr != "" {
-			playlistID, err = strconv.Atoi(playlistIDStr)
+		if playlistID := c.Query("playlistID"); playlistID != "" {
+			filter.PlaylistID, err = strconv.Atoi(playlistID)
 			if err != nil {
-				h.logger.Error("Invalid playlist ID", slog.Any("error", err))
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid playlist ID"})
+				problem.BadRequest(c, "Invalid playlist ID")
 				return
 			}
 		}
 
-		offset, err = strconv.Atoi(offsetStr)
+		ints := []struct {
+			param string
+			dst   *int
+		}{
+			{"artist_id", &filter.ArtistID},
+			{"album_id", &filter.AlbumID},
+			{"min_likes", &filter.MinLikes},
+			{"duration_gt", &filter.DurationGt},
+			{"duration_lt", &filter.DurationLt},
+		}
+		for _, p := range ints {
+			if value := c.Query(p.param); value != "" {
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					problem.BadRequest(c, "Invalid "+p.param)
+					return
+				}
+				*p.dst = n
+			}
+		}
+
+		times := []struct {
+			param string
+			dst   *time.Time
+		}{
+			{"created_after", &filter.CreatedAfter},
+			{"created_before", &filter.CreatedBefore},
+		}
+		for _, p := range times {
+			if value := c.Query(p.param); value != "" {
+				t, err := parseTime(value)
+				if err != nil {
+					problem.BadRequest(c, "Invalid "+p.param)
+					return
+				}
+				*p.dst = t
+			}
+		}
+
+		h.listTracks(c, &filter)
+	}
+}
+
+// parseTime accepts an RFC 3339 timestamp or a date, which stands for its
+// midnight in UTC. Times are returned in UTC, which is how they are stored.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), err
+}
+
+// GetArtistTracks lists the tracks an artist is credited on.
+func (h *Handler) GetArtistTracks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid artist ID")
+			return
+		}
+
+		h.listTracks(c, &models.TrackFilter{ArtistID: id})
+	}
+}
+
+// GetAlbumTracks lists the tracks of an album in disc and track order.
+func (h *Handler) GetAlbumTracks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid album ID")
+			return
+		}
+
+		h.listTracks(c, &models.TrackFilter{AlbumID: id})
+	}
+}
+
+// listTracks responds with a page of the tracks matching filter, sorted as
+// the sort parameter asks.
+func (h *Handler) listTracks(c *gin.Context, filter *models.TrackFilter) {
+	filter.Sort = c.Query("sort")
+
+	page, ok := paging.Request(c)
+	if !ok {
+		return
+	}
+
+	tracks, err := h.service.GetTracks(c.Request.Context(), filter, page)
+	if err != nil {
+		problem.Error(c, h.logger, err)
+		return
+	}
+
+	paging.Respond(c, tracks, NewTrackResponse)
+}
+
+// SetTrackArtists replaces the artists credited on a track.
+func (h *Handler) SetTrackArtists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			h.logger.Error("Invalid offset", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			problem.BadRequest(c, "Invalid track ID")
 			return
 		}
 
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil || limit < 1 {
-			h.logger.Error("Invalid limit", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		version, ok := precondition.IfMatch(c)
+		if !ok {
 			return
 		}
 
-		tracks, err := h.service.GetTracks(c.Request.Context(), name, artist, playlistID, offset, limit)
+		var request models.SetCreditsRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		track, err := h.service.SetTrackArtists(c.Request.Context(), principal, id, version, request.Artists)
 		if err != nil {
-			h.logger.Error("Error fetching tracks", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching tracks"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		var tracksResponse []models.TrackResponse
-		for _, track := range tracks {
-			trackResponse := models.TrackResponse{
-				ID:       track.ID,
-				Name:     track.Name,
-				Artist:   track.Artist,
-				URL:      track.URL,
-				Likes:    track.Likes,
-				Dislikes: track.Dislikes,
-			}
-			tracksResponse = append(tracksResponse, trackResponse)
+		precondition.SetETag(c, track.Version)
+		c.JSON(http.StatusOK, NewTrackResponse(track))
+	}
+}
+
+func (h *Handler) SetReaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid track ID")
+			return
 		}
 
-		c.JSON(http.StatusOK, tracksResponse)
+		var request models.ReactionRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request")
+			return
+		}
+
+		userID, exists := c.Get("userID")
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		reaction, err := h.service.SetReaction(c.Request.Context(), &models.Reaction{
+			UserID:  userID.(int),
+			TrackID: id,
+			Value:   request.Value,
+		})
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newReactionResponse(reaction))
+	}
+}
+
+func (h *Handler) RemoveReaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid track ID")
+			return
+		}
+
+		userID, exists := c.Get("userID")
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		reaction, err := h.service.RemoveReaction(c.Request.Context(), userID.(int), id)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newReactionResponse(reaction))
+	}
+}
+
+func (h *Handler) GetLikedTracks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, ok := paging.Request(c)
+		if !ok {
+			return
+		}
+
+		userID, exists := c.Get("userID")
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		tracks, err := h.service.GetLikedTracks(c.Request.Context(), userID.(int), page)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		paging.Respond(c, tracks, NewTrackResponse)
+	}
+}
+
+// GetMyTracks lists the tracks uploaded by the current user.
+func (h *Handler) GetMyTracks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, ok := paging.Request(c)
+		if !ok {
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		tracks, err := h.service.GetUserTracks(c.Request.Context(), principal.UserID, page)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		paging.Respond(c, tracks, NewTrackResponse)
+	}
+}
+
+func newReactionResponse(reaction *models.Reaction) models.ReactionResponse {
+	return models.ReactionResponse{
+		TrackID:  reaction.TrackID,
+		Value:    reaction.Value,
+		Likes:    reaction.Likes,
+		Dislikes: reaction.Dislikes,
+	}
+}
+
+// NewTrackResponse is the representation of a track in every response that
+// includes one.
+func NewTrackResponse(track *models.Track) models.TrackResponse {
+	return models.TrackResponse{
+		ID:          track.ID,
+		OwnerID:     track.OwnerID,
+		Name:        track.Name,
+		Artist:      track.Artist,
+		URL:         track.URL,
+		Likes:       track.Likes,
+		Dislikes:    track.Dislikes,
+		Size:        track.Size,
+		MimeType:    track.MimeType,
+		Checksum:    track.Checksum,
+		Album:       track.Album,
+		TrackNumber: track.TrackNumber,
+		Year:        track.Year,
+		Genre:       track.Genre,
+		DurationMs:  track.DurationMs,
+		Bitrate:     track.Bitrate,
+		Codec:       track.Codec,
+		SampleRate:  track.SampleRate,
+		Channels:    track.Channels,
+		CoverURL:    coverURL(track),
+		AlbumID:     track.AlbumID,
+		DiscNumber:  track.DiscNumber,
+		Artists:     track.Artists,
+		Plays:       track.Plays,
+		CreatedAt:   track.CreatedAt,
+		Version:     track.Version,
+	}
+}
+
+func coverURL(track *models.Track) string {
+	if track.CoverKey == "" {
+		return ""
 	}
+	return fmt.Sprintf("/api/v1/tracks/%d/cover", track.ID)
 }
@@ -0,0 +1,165 @@
+package track
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"music-hosting/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamService serves a single track from memory and counts its plays.
+// Calling any other method of Service panics.
+type streamService struct {
+	Service
+	track *models.Track
+	audio []byte
+	plays int
+}
+
+func (s *streamService) GetTrackByID(ctx context.Context, id int) (*models.Track, error) {
+	return s.track, nil
+}
+
+func (s *streamService) OpenTrackAudio(ctx context.Context, track *models.Track) (io.ReadSeekCloser, time.Time, error) {
+	return nopCloser{bytes.NewReader(s.audio)}, time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC), nil
+}
+
+func (s *streamService) RecordPlay(ctx context.Context, id int) error {
+	s.plays++
+	return nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestStreamTrack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	audio := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	tests := []struct {
+		name      string
+		method    string
+		header    http.Header
+		wantCode  int
+		wantBody  string
+		wantRange string
+		wantPlays int
+	}{
+		{
+			name:      "whole file",
+			method:    http.MethodGet,
+			wantCode:  http.StatusOK,
+			wantBody:  string(audio),
+			wantPlays: 1,
+		},
+		{
+			name:      "open-ended range from the start",
+			method:    http.MethodGet,
+			header:    http.Header{"Range": {"bytes=0-"}},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  string(audio),
+			wantRange: "bytes 0-35/36",
+			wantPlays: 1,
+		},
+		{
+			name:      "seek",
+			method:    http.MethodGet,
+			header:    http.Header{"Range": {"bytes=10-19"}},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "abcdefghij",
+			wantRange: "bytes 10-19/36",
+		},
+		{
+			name:      "probe of the first bytes",
+			method:    http.MethodGet,
+			header:    http.Header{"Range": {"bytes=0-1"}},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "01",
+			wantRange: "bytes 0-1/36",
+		},
+		{
+			name:      "suffix range",
+			method:    http.MethodGet,
+			header:    http.Header{"Range": {"bytes=-4"}},
+			wantCode:  http.StatusPartialContent,
+			wantBody:  "wxyz",
+			wantRange: "bytes 32-35/36",
+		},
+		{
+			name:     "unsatisfiable range",
+			method:   http.MethodGet,
+			header:   http.Header{"Range": {"bytes=100-"}},
+			wantCode: http.StatusRequestedRangeNotSatisfiable,
+		},
+		{
+			name:     "not modified",
+			method:   http.MethodGet,
+			header:   http.Header{"If-None-Match": {`"abc123"`}},
+			wantCode: http.StatusNotModified,
+		},
+		{
+			name:     "stale If-Range",
+			method:   http.MethodGet,
+			header:   http.Header{"Range": {"bytes=10-19"}, "If-Range": {`"other"`}},
+			wantCode: http.StatusOK,
+			// The whole file is sent in place of the range, but as part of
+			// a seek rather than a new play.
+			wantBody: string(audio),
+		},
+		{
+			name:     "head",
+			method:   http.MethodHead,
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &streamService{
+				track: &models.Track{ID: 1, MimeType: "audio/mpeg", Checksum: "abc123"},
+				audio: audio,
+			}
+			h := NewHandler(service, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			router := gin.New()
+			router.GET("/tracks/:id/stream", h.StreamTrack())
+			router.HEAD("/tracks/:id/stream", h.StreamTrack())
+
+			req := httptest.NewRequest(tt.method, "/tracks/1/stream", nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Body.String(); tt.wantCode < 400 && got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Range"); tt.wantRange != "" && got != tt.wantRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.wantRange)
+			}
+			if got := w.Header().Get("Accept-Ranges"); tt.wantCode < 300 && got != "bytes" {
+				t.Errorf("Accept-Ranges = %q, want bytes", got)
+			}
+			if got := w.Header().Get("ETag"); tt.wantCode < 400 && got != `"abc123"` {
+				t.Errorf("ETag = %q, want the checksum", got)
+			}
+			if service.plays != tt.wantPlays {
+				t.Errorf("plays recorded = %d, want %d", service.plays, tt.wantPlays)
+			}
+		})
+	}
+}
@@ -2,9 +2,11 @@ package user
 
 import (
 	"context"
-	"database/sql"
-	"errors"
 	"log/slog"
+	"music-hosting/internal/http/mergepatch"
+	"music-hosting/internal/http/paging"
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/middleware"
 	"music-hosting/internal/models"
 	"net/http"
 	"strconv"
@@ -15,10 +17,24 @@ import (
 type Service interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUser(ctx context.Context, id int) (*models.User, error)
-	GetUsersWithPagination(ctx context.Context, limit, offset string) ([]*models.User, error)
-	UpdateUser(ctx context.Context, id int, user *models.User) error
-	DeleteUser(ctx context.Context, id int) error
-	GetToken(ctx context.Context, login string, password string) (string, error)
+	GetUsersWithPagination(ctx context.Context, page *models.PageRequest) (*models.Page[*models.User], error)
+	UpdateUser(ctx context.Context, principal *models.Principal, id int, user *models.User) error
+	PatchUser(ctx context.Context, principal *models.Principal, id int, patch *models.UserPatch) (*models.User, error)
+	ChangePassword(ctx context.Context, principal *models.Principal, currentPassword, newPassword string) error
+	UpdateUserRole(ctx context.Context, id int, role string) error
+	DeleteUser(ctx context.Context, principal *models.Principal, id int) error
+	GetToken(ctx context.Context, login string, password string) (*models.LoginResult, error)
+	CompleteTwoFactorLogin(ctx context.Context, challengeToken, code string) (*models.Tokens, error)
+	EnrollTwoFactor(ctx context.Context, userID int) (*models.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, userID int, code string) error
+	DisableTwoFactor(ctx context.Context, userID int, code string) error
+	SendVerificationEmail(ctx context.Context, userID int) error
+	VerifyEmail(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	RefreshToken(ctx context.Context, refreshToken string) (*models.Tokens, error)
+	Logout(ctx context.Context, sessionID int) error
+	LogoutAll(ctx context.Context, userID int) error
 }
 
 type Handler struct {
@@ -35,8 +51,7 @@ func (h *Handler) CreateUser() gin.HandlerFunc {
 		var user models.UserRequest
 
 		if err := c.ShouldBindJSON(&user); err != nil {
-			h.logger.Error("Invalid request", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			problem.BadRequest(c, "Invalid request body")
 			return
 		}
 
@@ -48,8 +63,7 @@ func (h *Handler) CreateUser() gin.HandlerFunc {
 
 		err := h.service.CreateUser(c.Request.Context(), &userServ)
 		if err != nil {
-			h.logger.Error("Failed to create user", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
@@ -61,31 +75,99 @@ func (h *Handler) GetUserID() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			h.logger.Error("Invalid user id parameter", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			problem.BadRequest(c, "Invalid user ID")
 			return
 		}
 
 		user, err := h.service.GetUser(c.Request.Context(), id)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				h.logger.Error("User not found", slog.Any("error", err))
-				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-				return
-			}
+			problem.Error(c, h.logger, err)
+			return
+		}
 
-			h.logger.Error("Failed to retrieve user", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		c.JSON(http.StatusOK, newUserResponse(user))
+	}
+}
+
+func (h *Handler) GetMe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
 			return
 		}
 
-		userResponse := models.UserResponse{
-			ID:    user.ID,
-			Login: user.Login,
-			Email: user.Email,
+		user, err := h.service.GetUser(c.Request.Context(), principal.UserID)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newUserResponse(user))
+	}
+}
+
+func (h *Handler) UpdateMe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		var patch models.UserPatch
+		if !mergepatch.Bind(c, &patch) {
+			return
+		}
+
+		user, err := h.service.PatchUser(c.Request.Context(), principal, principal.UserID, &patch)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newUserResponse(user))
+	}
+}
+
+func (h *Handler) DeleteMe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		if err := h.service.DeleteUser(c.Request.Context(), principal, principal.UserID); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) ChangePassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		var request models.ChangePasswordRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		err := h.service.ChangePassword(c.Request.Context(), principal, request.CurrentPassword, request.NewPassword)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
 		}
 
-		c.JSON(http.StatusOK, userResponse)
+		c.Status(http.StatusNoContent)
 	}
 }
 
@@ -93,33 +175,30 @@ func (h *Handler) UpdateUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			h.logger.Error("Invalid user id parameter", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			problem.BadRequest(c, "Invalid user ID")
 			return
 		}
 
-		var user models.UserRequest
+		var user models.UpdateUserRequest
 		if err := c.ShouldBindJSON(&user); err != nil {
-			h.logger.Error("Invalid request body", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			problem.BadRequest(c, "Invalid request body")
 			return
 		}
 
 		userServ := models.User{
-			Login:    user.Login,
-			Email:    user.Email,
-			Password: user.Password,
+			Login: user.Login,
+			Email: user.Email,
 		}
 
-		err = h.service.UpdateUser(c.Request.Context(), id, &userServ)
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		err = h.service.UpdateUser(c.Request.Context(), principal, id, &userServ)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				h.logger.Error("User not found", slog.Any("error", err))
-				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-				return
-			}
-			h.logger.Error("Failed to update user", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
@@ -127,24 +206,52 @@ func (h *Handler) UpdateUser() gin.HandlerFunc {
 	}
 }
 
-func (h *Handler) DeleteUser() gin.HandlerFunc {
+func (h *Handler) PatchUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			h.logger.Error("Invalid user id parameter", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			problem.BadRequest(c, "Invalid user ID")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		var patch models.UserPatch
+		if !mergepatch.Bind(c, &patch) {
 			return
 		}
 
-		err = h.service.DeleteUser(c.Request.Context(), id)
+		user, err := h.service.PatchUser(c.Request.Context(), principal, id, &patch)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				h.logger.Error("User not found", slog.Any("error", err))
-				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-				return
-			}
-			h.logger.Error("Failed to delete user", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newUserResponse(user))
+	}
+}
+
+func (h *Handler) UpdateUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid user ID")
+			return
+		}
+
+		var request models.RoleRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		err = h.service.UpdateUserRole(c.Request.Context(), id, request.Role)
+		if err != nil {
+			problem.Error(c, h.logger, err)
 			return
 		}
 
@@ -152,29 +259,44 @@ func (h *Handler) DeleteUser() gin.HandlerFunc {
 	}
 }
 
-func (h *Handler) GetUserWithPagination() gin.HandlerFunc {
+func (h *Handler) DeleteUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		offset := c.DefaultQuery("offset", "0")
-		limit := c.DefaultQuery("limit", "10")
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.BadRequest(c, "Invalid user ID")
+			return
+		}
+
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
 
-		users, err := h.service.GetUsersWithPagination(c.Request.Context(), limit, offset)
+		err = h.service.DeleteUser(c.Request.Context(), principal, id)
 		if err != nil {
-			h.logger.Error("Failed to retrieve users with pagination", slog.Any("error", err))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+			problem.Error(c, h.logger, err)
 			return
 		}
 
-		var usersResponse []models.UserResponse
-		for _, user := range users {
-			userResponse := models.UserResponse{
-				ID:    user.ID,
-				Login: user.Login,
-				Email: user.Email,
-			}
-			usersResponse = append(usersResponse, userResponse)
+		c.JSON(http.StatusOK, nil)
+	}
+}
+
+func (h *Handler) GetUserWithPagination() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, ok := paging.Request(c)
+		if !ok {
+			return
 		}
 
-		c.JSON(http.StatusOK, usersResponse)
+		users, err := h.service.GetUsersWithPagination(c.Request.Context(), page)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		paging.Respond(c, users, newUserResponse)
 	}
 }
 
@@ -183,22 +305,258 @@ func (h *Handler) Login() gin.HandlerFunc {
 		var user models.UserRequest
 
 		if err := c.ShouldBindJSON(&user); err != nil {
-			h.logger.Error("Invalid request", slog.Any("error", err))
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			problem.BadRequest(c, "Invalid request body")
 			return
 		}
 
-		token, err := h.service.GetToken(c.Request.Context(), user.Login, user.Password)
+		result, err := h.service.GetToken(c.Request.Context(), user.Login, user.Password)
 		if err != nil {
-			h.logger.Error("User not found", slog.Any("error", err))
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		if result.Tokens == nil {
+			c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{
+				TwoFactorRequired: true,
+				ChallengeToken:    result.ChallengeToken,
+				ExpiresIn:         int(result.ChallengeExpiresIn.Seconds()),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, newTokenResponse(result.Tokens))
+	}
+}
+
+func (h *Handler) LoginTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.TwoFactorLoginRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
 			return
 		}
 
-		tokenResponse := models.TokenResponse{
-			Token: token,
+		tokens, err := h.service.CompleteTwoFactorLogin(c.Request.Context(), request.ChallengeToken, request.Code)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
 		}
 
-		c.JSON(http.StatusOK, tokenResponse)
+		c.JSON(http.StatusOK, newTokenResponse(tokens))
+	}
+}
+
+func (h *Handler) EnrollTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		enrollment, err := h.service.EnrollTwoFactor(c.Request.Context(), principal.UserID)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, models.TwoFactorEnrollmentResponse{
+			Secret:        enrollment.Secret,
+			URI:           enrollment.URI,
+			RecoveryCodes: enrollment.RecoveryCodes,
+		})
+	}
+}
+
+func (h *Handler) ConfirmTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		var request models.TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		if err := h.service.ConfirmTwoFactor(c.Request.Context(), principal.UserID, request.Code); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) DisableTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		var request models.TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		if err := h.service.DisableTwoFactor(c.Request.Context(), principal.UserID, request.Code); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// VerifyEmail accepts the token either as the query parameter of the link
+// sent by email or in a JSON body.
+func (h *Handler) VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			var request models.VerifyEmailRequest
+			if err := c.ShouldBindJSON(&request); err != nil {
+				problem.BadRequest(c, "Invalid request body")
+				return
+			}
+			token = request.Token
+		}
+
+		err := h.service.VerifyEmail(c.Request.Context(), token)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+	}
+}
+
+func (h *Handler) ResendVerificationEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		err := h.service.SendVerificationEmail(c.Request.Context(), principal.UserID)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusAccepted)
+	}
+}
+
+func (h *Handler) ForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.ForgotPasswordRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		if err := h.service.RequestPasswordReset(c.Request.Context(), request.Email); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		// The response is the same whether or not the address is known.
+		c.Status(http.StatusAccepted)
+	}
+}
+
+func (h *Handler) ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.ResetPasswordRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		err := h.service.ResetPassword(c.Request.Context(), request.Token, request.Password)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) RefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.RefreshRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.BadRequest(c, "Invalid request body")
+			return
+		}
+
+		tokens, err := h.service.RefreshToken(c.Request.Context(), request.RefreshToken)
+		if err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, newTokenResponse(tokens))
+	}
+}
+
+func (h *Handler) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		if err := h.service.Logout(c.Request.Context(), principal.SessionID); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (h *Handler) LogoutAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, exists := middleware.CurrentUser(c)
+		if !exists {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
+			return
+		}
+
+		if err := h.service.LogoutAll(c.Request.Context(), principal.UserID); err != nil {
+			problem.Error(c, h.logger, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func newUserResponse(user *models.User) models.UserResponse {
+	return models.UserResponse{
+		ID:    user.ID,
+		Login: user.Login,
+		Email: user.Email,
+		Role:  user.Role,
+	}
+}
+
+func newTokenResponse(tokens *models.Tokens) models.TokenResponse {
+	return models.TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
 	}
 }
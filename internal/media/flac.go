@@ -0,0 +1,157 @@
+package media
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+)
+
+// readFLACBlocks walks the metadata blocks that follow the "fLaC" marker
+// and calls fn for each of them.
+func readFLACBlocks(r io.Reader, fn func(blockType byte, data []byte)) error {
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return fmt.Errorf("failed to read flac marker: %w", err)
+	}
+
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return fmt.Errorf("failed to read flac block header: %w", err)
+		}
+
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		data, err := readBlock(r, int64(size))
+		if err != nil {
+			return fmt.Errorf("failed to read flac block: %w", err)
+		}
+
+		fn(blockType, data)
+
+		if last {
+			return nil
+		}
+	}
+}
+
+func readFLAC(r io.Reader, tags *Tags) error {
+	return readFLACBlocks(r, func(blockType byte, data []byte) {
+		switch blockType {
+		case flacBlockVorbisComment:
+			readVorbisComments(data, tags)
+		case flacBlockPicture:
+			if tags.Picture == nil {
+				tags.Picture = parseFLACPicture(data)
+			}
+		}
+	})
+}
+
+// readVorbisComments parses a Vorbis comment block: a vendor string
+// followed by a list of "KEY=value" fields, all little-endian length-prefixed.
+func readVorbisComments(data []byte, tags *Tags) {
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint32(data))
+		if n > len(data)-4 {
+			return nil, false
+		}
+		value := data[4 : 4+n]
+		data = data[4+n:]
+		return value, true
+	}
+
+	if _, ok := next(); !ok {
+		return
+	}
+
+	if len(data) < 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(data))
+	data = data[4:]
+
+	for i := 0; i < count; i++ {
+		field, ok := next()
+		if !ok {
+			return
+		}
+		tags.setVorbisComment(string(field))
+	}
+}
+
+func parseFLACPicture(data []byte) *Picture {
+	next := func(n int) ([]byte, bool) {
+		if n < 0 || n > len(data) {
+			return nil, false
+		}
+		value := data[:n]
+		data = data[n:]
+		return value, true
+	}
+
+	nextUint32 := func() (int, bool) {
+		b, ok := next(4)
+		if !ok {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint32(b)), true
+	}
+
+	if _, ok := nextUint32(); !ok {
+		return nil
+	}
+
+	mimeLen, ok := nextUint32()
+	if !ok {
+		return nil
+	}
+	mime, ok := next(mimeLen)
+	if !ok {
+		return nil
+	}
+
+	descLen, ok := nextUint32()
+	if !ok {
+		return nil
+	}
+	if _, ok := next(descLen); !ok {
+		return nil
+	}
+
+	// Width, height, colour depth and palette size.
+	if _, ok := next(16); !ok {
+		return nil
+	}
+
+	dataLen, ok := nextUint32()
+	if !ok {
+		return nil
+	}
+	picture, ok := next(dataLen)
+	if !ok || len(picture) == 0 {
+		return nil
+	}
+
+	return &Picture{MIMEType: normalizeImageMIME(string(mime)), Data: picture}
+}
+
+func parseEncodedFLACPicture(value string) *Picture {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	return parseFLACPicture(data)
+}
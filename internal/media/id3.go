@@ -0,0 +1,374 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	id3HeaderSize = 10
+	id3v1Size     = 128
+)
+
+// readID3v2 parses an ID3v2.2, v2.3 or v2.4 tag at the start of r.
+func readID3v2(r io.Reader, tags *Tags) error {
+	_, data, err := readID3v2Tag(r)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+
+	version := data[0]
+	data = data[1:]
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+
+	for len(data) >= headerSize {
+		id := string(data[:idSize])
+		if id[0] == 0 {
+			break
+		}
+
+		var size int
+		var flags uint16
+		switch version {
+		case 2:
+			size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(data[4:8]))
+			flags = binary.BigEndian.Uint16(data[8:10])
+		default:
+			size = syncsafe(data[4:8])
+			flags = binary.BigEndian.Uint16(data[8:10])
+		}
+
+		data = data[headerSize:]
+		if size > len(data) {
+			break
+		}
+		frame := data[:size]
+		data = data[size:]
+
+		frame, ok := decodeFrameFlags(version, flags, frame)
+		if !ok {
+			continue
+		}
+
+		applyID3Frame(tags, id, frame)
+	}
+
+	return nil
+}
+
+// readID3v2Tag returns the tag version byte followed by the frame data,
+// or nil if r does not start with an ID3v2 tag. It also returns the full
+// tag size so callers can skip over it.
+func readID3v2Tag(r io.Reader) (int64, []byte, error) {
+	header := make([]byte, id3HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, fmt.Errorf("failed to read id3 header: %w", err)
+	}
+
+	if !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0, nil, nil
+	}
+
+	version := header[3]
+	flags := header[5]
+	size := syncsafe(header[6:10])
+	tagSize := int64(id3HeaderSize + size)
+	if flags&0x10 != 0 {
+		tagSize += id3HeaderSize
+	}
+
+	if version < 2 || version > 4 {
+		return tagSize, nil, nil
+	}
+
+	data, err := readBlock(r, int64(size))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read id3 tag: %w", err)
+	}
+
+	if flags&0x80 != 0 && version < 4 {
+		data = removeUnsync(data)
+	}
+
+	if flags&0x40 != 0 && version > 2 && len(data) >= 4 {
+		extSize := int(binary.BigEndian.Uint32(data[:4])) + 4
+		if version == 4 {
+			extSize = syncsafe(data[:4])
+		}
+		if extSize > len(data) {
+			return tagSize, nil, nil
+		}
+		data = data[extSize:]
+	}
+
+	return tagSize, append([]byte{version}, data...), nil
+}
+
+func decodeFrameFlags(version byte, flags uint16, frame []byte) ([]byte, bool) {
+	switch version {
+	case 3:
+		// Compressed or encrypted frames are skipped.
+		if flags&0x00c0 != 0 {
+			return nil, false
+		}
+	case 4:
+		if flags&0x000c != 0 {
+			return nil, false
+		}
+		if flags&0x0002 != 0 {
+			frame = removeUnsync(frame)
+		}
+		if flags&0x0001 != 0 {
+			if len(frame) < 4 {
+				return nil, false
+			}
+			frame = frame[4:]
+		}
+	}
+	return frame, true
+}
+
+func applyID3Frame(tags *Tags, id string, frame []byte) {
+	switch id {
+	case "TIT2", "TT2":
+		setString(&tags.Title, decodeID3Text(frame))
+	case "TPE1", "TP1":
+		setString(&tags.Artist, decodeID3Text(frame))
+	case "TALB", "TAL":
+		setString(&tags.Album, decodeID3Text(frame))
+	case "TCON", "TCO":
+		setString(&tags.Genre, parseID3Genre(decodeID3Text(frame)))
+	case "TRCK", "TRK":
+		setInt(&tags.TrackNumber, parseNumber(decodeID3Text(frame)))
+	case "TYER", "TYE", "TDRC":
+		setInt(&tags.Year, parseNumber(decodeID3Text(frame)))
+	case "TLEN", "TLE":
+		if ms := parseNumber(decodeID3Text(frame)); ms > 0 && tags.Duration == 0 {
+			tags.Duration = time.Duration(ms) * time.Millisecond
+		}
+	case "APIC":
+		if tags.Picture == nil {
+			tags.Picture = parseAPIC(frame)
+		}
+	case "PIC":
+		if tags.Picture == nil {
+			tags.Picture = parsePIC(frame)
+		}
+	}
+}
+
+// decodeID3Text decodes a text frame and returns its first value.
+func decodeID3Text(frame []byte) string {
+	if len(frame) < 1 {
+		return ""
+	}
+
+	text, _ := splitID3String(frame[0], frame[1:])
+	return strings.TrimSpace(text)
+}
+
+// splitID3String decodes a terminated string in the given encoding and
+// returns it with the bytes that follow the terminator.
+func splitID3String(encoding byte, data []byte) (string, []byte) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return decodeUTF16(encoding, data[:i]), data[i+2:]
+			}
+		}
+		return decodeUTF16(encoding, data), nil
+	}
+
+	value, rest := data, []byte(nil)
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		value, rest = data[:i], data[i+1:]
+	}
+
+	if encoding == 3 {
+		return string(value), rest
+	}
+	return decodeLatin1(value), rest
+}
+
+func decodeUTF16(encoding byte, data []byte) string {
+	order := binary.ByteOrder(binary.BigEndian)
+	if encoding == 1 && len(data) >= 2 {
+		switch {
+		case data[0] == 0xff && data[1] == 0xfe:
+			order = binary.LittleEndian
+			data = data[2:]
+		case data[0] == 0xfe && data[1] == 0xff:
+			data = data[2:]
+		}
+	}
+
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeLatin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func parseAPIC(frame []byte) *Picture {
+	if len(frame) < 2 {
+		return nil
+	}
+
+	encoding := frame[0]
+	mime, rest := splitID3String(0, frame[1:])
+	if len(rest) < 1 {
+		return nil
+	}
+
+	_, data := splitID3String(encoding, rest[1:])
+	if len(data) == 0 {
+		return nil
+	}
+
+	return &Picture{MIMEType: normalizeImageMIME(mime), Data: data}
+}
+
+func parsePIC(frame []byte) *Picture {
+	if len(frame) < 5 {
+		return nil
+	}
+
+	format := strings.ToLower(string(frame[1:4]))
+	_, data := splitID3String(frame[0], frame[5:])
+	if len(data) == 0 {
+		return nil
+	}
+
+	return &Picture{MIMEType: normalizeImageMIME(format), Data: data}
+}
+
+func normalizeImageMIME(mime string) string {
+	mime = strings.ToLower(strings.TrimSpace(mime))
+	switch mime {
+	case "jpg", "jpeg", "image/jpg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	}
+	if !strings.Contains(mime, "/") {
+		return "image/" + mime
+	}
+	return mime
+}
+
+// parseID3Genre resolves numeric references such as "(17)" or "17" to
+// their ID3v1 genre names.
+func parseID3Genre(genre string) string {
+	if strings.HasPrefix(genre, "(") {
+		if end := strings.IndexByte(genre, ')'); end > 0 {
+			if rest := strings.TrimSpace(genre[end+1:]); rest != "" {
+				return rest
+			}
+			genre = genre[1:end]
+		}
+	}
+
+	if n, err := strconv.Atoi(genre); err == nil {
+		if n >= 0 && n < len(id3v1Genres) {
+			return id3v1Genres[n]
+		}
+		return ""
+	}
+
+	return genre
+}
+
+// readID3v1 reads the 128 byte ID3v1 tag at the end of r, if present.
+func readID3v1(r io.ReadSeeker, tags *Tags) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if size < id3v1Size {
+		return nil
+	}
+
+	if _, err := r.Seek(-id3v1Size, io.SeekEnd); err != nil {
+		return err
+	}
+
+	data := make([]byte, id3v1Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("failed to read id3v1 tag: %w", err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("TAG")) {
+		return nil
+	}
+
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimSpace(decodeLatin1(b))
+	}
+
+	setString(&tags.Title, field(data[3:33]))
+	setString(&tags.Artist, field(data[33:63]))
+	setString(&tags.Album, field(data[63:93]))
+	setInt(&tags.Year, parseNumber(field(data[93:97])))
+	if data[125] == 0 && data[126] != 0 {
+		setInt(&tags.TrackNumber, int(data[126]))
+	}
+	if int(data[127]) < len(id3v1Genres) {
+		setString(&tags.Genre, id3v1Genres[data[127]])
+	}
+
+	return nil
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func removeUnsync(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+}
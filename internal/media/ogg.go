@@ -0,0 +1,114 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const oggPageHeaderSize = 27
+
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	segments   []byte
+	data       []byte
+}
+
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, oggPageHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(header, []byte("OggS")) {
+		return nil, fmt.Errorf("invalid ogg page")
+	}
+
+	page := &oggPage{
+		headerType: header[5],
+		granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:     binary.LittleEndian.Uint32(header[14:18]),
+		segments:   make([]byte, header[26]),
+	}
+
+	if _, err := io.ReadFull(r, page.segments); err != nil {
+		return nil, err
+	}
+
+	size := 0
+	for _, s := range page.segments {
+		size += int(s)
+	}
+
+	page.data = make([]byte, size)
+	if _, err := io.ReadFull(r, page.data); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// readOggPackets reassembles the first n packets of the first logical
+// stream in r.
+func readOggPackets(r io.Reader, n int) ([][]byte, error) {
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+	first := true
+
+	for len(packets) < n {
+		page, err := readOggPage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return packets, nil
+			}
+			return nil, fmt.Errorf("failed to read ogg page: %w", err)
+		}
+
+		if first {
+			serial = page.serial
+			first = false
+		} else if page.serial != serial {
+			continue
+		}
+
+		offset := 0
+		for _, size := range page.segments {
+			current = append(current, page.data[offset:offset+int(size)]...)
+			offset += int(size)
+			if size < 255 {
+				packets = append(packets, current)
+				current = nil
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+	}
+
+	return packets, nil
+}
+
+func readOgg(r io.Reader, tags *Tags) error {
+	packets, err := readOggPackets(r, 2)
+	if err != nil {
+		return err
+	}
+	if len(packets) < 2 {
+		return nil
+	}
+
+	comments := packets[1]
+	switch {
+	case bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		readVorbisComments(comments[7:], tags)
+	case bytes.HasPrefix(comments, []byte("OpusTags")):
+		readVorbisComments(comments[8:], tags)
+	}
+
+	return nil
+}
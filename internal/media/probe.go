@@ -0,0 +1,453 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// maxDuration is the longest duration a header is believed about. Sample
+// counts come straight from the file, and a corrupt one can claim years.
+const maxDuration = 100 * time.Hour
+
+type Info struct {
+	Codec      string
+	Duration   time.Duration
+	Bitrate    int
+	SampleRate int
+	Channels   int
+}
+
+// Probe reads the stream headers of an MP3, FLAC, Ogg Vorbis/Opus or WAV
+// file and reports its technical properties. r is rewound before returning.
+func Probe(r io.ReadSeeker) (*Info, error) {
+	defer r.Seek(0, io.SeekStart)
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := skipID3v2(r)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 12)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("fLaC")):
+		return probeFLAC(r, size-start)
+	case bytes.HasPrefix(magic, []byte("OggS")):
+		return probeOgg(r, size)
+	case bytes.HasPrefix(magic, []byte("RIFF")) && bytes.Equal(magic[8:12], []byte("WAVE")):
+		return probeWAV(r)
+	default:
+		return probeMP3(r, start, size)
+	}
+}
+
+// skipID3v2 positions r after a leading ID3v2 tag and returns that offset.
+func skipID3v2(r io.ReadSeeker) (int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, id3HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	var start int64
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		start = int64(id3HeaderSize + syncsafe(header[6:10]))
+		if header[5]&0x10 != 0 {
+			start += id3HeaderSize
+		}
+	}
+
+	_, err := r.Seek(start, io.SeekStart)
+	return start, err
+}
+
+var (
+	mp3Bitrates = map[[2]int][]int{
+		{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3SampleRates = map[int][]int{
+		1: {44100, 48000, 32000},
+		2: {22050, 24000, 16000},
+		3: {11025, 12000, 8000},
+	}
+)
+
+type mp3Frame struct {
+	version    int // 1 = MPEG1, 2 = MPEG2, 3 = MPEG2.5
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+}
+
+func parseMP3Header(h []byte) (*mp3Frame, bool) {
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return nil, false
+	}
+
+	var frame mp3Frame
+	switch (h[1] >> 3) & 0x03 {
+	case 0:
+		frame.version = 3
+	case 2:
+		frame.version = 2
+	case 3:
+		frame.version = 1
+	default:
+		return nil, false
+	}
+
+	frame.layer = 4 - int((h[1]>>1)&0x03)
+	if frame.layer == 4 {
+		return nil, false
+	}
+
+	tableVersion := frame.version
+	if tableVersion == 3 {
+		tableVersion = 2
+	}
+
+	bitrateIndex := int(h[2] >> 4)
+	sampleRateIndex := int((h[2] >> 2) & 0x03)
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return nil, false
+	}
+
+	frame.bitrate = mp3Bitrates[[2]int{tableVersion, frame.layer}][bitrateIndex] * 1000
+	frame.sampleRate = mp3SampleRates[frame.version][sampleRateIndex]
+
+	frame.channels = 2
+	if h[3]>>6 == 3 {
+		frame.channels = 1
+	}
+
+	return &frame, true
+}
+
+func (f *mp3Frame) samplesPerFrame() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// sideInfoSize is the distance from the end of a layer III frame header to
+// where a Xing/Info header would start.
+func (f *mp3Frame) sideInfoSize() int {
+	switch {
+	case f.version == 1 && f.channels == 1:
+		return 17
+	case f.version == 1:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+func probeMP3(r io.ReadSeeker, start, size int64) (*Info, error) {
+	// The first frame normally follows the ID3 tag directly, but encoders
+	// sometimes leave padding, so scan a bounded window for the sync word.
+	buf := make([]byte, 64*1024)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("failed to read mp3 frames: %w", err)
+	}
+	buf = buf[:n]
+
+	var frame *mp3Frame
+	offset := 0
+	for ; offset+4 <= len(buf); offset++ {
+		if f, ok := parseMP3Header(buf[offset:]); ok {
+			frame = f
+			break
+		}
+	}
+	if frame == nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	codec := fmt.Sprintf("mp%d", frame.layer)
+	info := &Info{
+		Codec:      codec,
+		SampleRate: frame.sampleRate,
+		Channels:   frame.channels,
+		Bitrate:    frame.bitrate,
+	}
+
+	audioSize := size - start - int64(offset)
+	if hasID3v1(r, size) {
+		audioSize -= id3v1Size
+	}
+
+	frames := vbrFrameCount(buf[offset:], frame)
+	if frames > 0 {
+		info.Duration = durationOf(int64(frames)*int64(frame.samplesPerFrame()), int64(frame.sampleRate))
+		info.Bitrate = bitrateOf(audioSize, info.Duration, info.Bitrate)
+		return info, nil
+	}
+
+	info.Duration = durationOf(audioSize*8, int64(frame.bitrate))
+
+	return info, nil
+}
+
+// vbrFrameCount reads the total frame count from a Xing/Info or VBRI header
+// in the first frame, or returns 0 for constant bitrate files.
+func vbrFrameCount(frame []byte, f *mp3Frame) int {
+	xing := 4 + f.sideInfoSize()
+	if len(frame) >= xing+12 {
+		tag := string(frame[xing : xing+4])
+		if tag == "Xing" || tag == "Info" {
+			flags := binary.BigEndian.Uint32(frame[xing+4:])
+			if flags&0x01 != 0 {
+				return int(binary.BigEndian.Uint32(frame[xing+8:]))
+			}
+		}
+	}
+
+	const vbri = 36
+	if len(frame) >= vbri+18 && string(frame[vbri:vbri+4]) == "VBRI" {
+		return int(binary.BigEndian.Uint32(frame[vbri+14:]))
+	}
+
+	return 0
+}
+
+func hasID3v1(r io.ReadSeeker, size int64) bool {
+	if size < id3v1Size {
+		return false
+	}
+	if _, err := r.Seek(-id3v1Size, io.SeekEnd); err != nil {
+		return false
+	}
+	magic := make([]byte, 3)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return false
+	}
+	return string(magic) == "TAG"
+}
+
+func probeFLAC(r io.Reader, size int64) (*Info, error) {
+	var info *Info
+	err := readFLACBlocks(r, func(blockType byte, data []byte) {
+		if blockType != flacBlockStreamInfo || len(data) < 18 {
+			return
+		}
+
+		v := binary.BigEndian.Uint64(data[10:18])
+		sampleRate := int(v >> 44)
+		totalSamples := int64(v & 0xfffffffff)
+
+		info = &Info{
+			Codec:      "flac",
+			SampleRate: sampleRate,
+			Channels:   int((v>>41)&0x07) + 1,
+		}
+		info.Duration = durationOf(totalSamples, int64(sampleRate))
+		info.Bitrate = bitrateOf(size, info.Duration, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	return info, nil
+}
+
+func probeOgg(r io.ReadSeeker, size int64) (*Info, error) {
+	page, err := readOggPage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ogg page: %w", err)
+	}
+
+	head := page.data
+	info := &Info{}
+	var preSkip int64
+
+	switch {
+	case bytes.HasPrefix(head, []byte("\x01vorbis")) && len(head) >= 28:
+		info.Codec = "vorbis"
+		info.Channels = int(head[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(head[12:16]))
+		info.Bitrate = int(int32(binary.LittleEndian.Uint32(head[20:24])))
+	case bytes.HasPrefix(head, []byte("OpusHead")) && len(head) >= 19:
+		// Opus always decodes at 48 kHz; the header only records the
+		// original input rate.
+		info.Codec = "opus"
+		info.Channels = int(head[9])
+		info.SampleRate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(head[10:12]))
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	granule, err := lastOggGranule(r, size, page.serial)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Duration = durationOf(granule-preSkip, int64(info.SampleRate))
+	if info.Bitrate <= 0 {
+		info.Bitrate = bitrateOf(size, info.Duration, 0)
+	}
+
+	return info, nil
+}
+
+// lastOggGranule finds the granule position of the last page of the given
+// logical stream, which is its total length in samples.
+func lastOggGranule(r io.ReadSeeker, size int64, serial uint32) (int64, error) {
+	const window = 64 * 1024
+
+	offset := size - window
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read ogg tail: %w", err)
+	}
+
+	for i := bytes.LastIndex(buf, []byte("OggS")); i >= 0; i = bytes.LastIndex(buf[:i], []byte("OggS")) {
+		if len(buf)-i < oggPageHeaderSize {
+			continue
+		}
+		header := buf[i:]
+		granule := int64(binary.LittleEndian.Uint64(header[6:14]))
+		if binary.LittleEndian.Uint32(header[14:18]) == serial && granule >= 0 {
+			return granule, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func probeWAV(r io.Reader) (*Info, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read wav header: %w", err)
+	}
+
+	info := &Info{}
+	var byteRate int
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			if info.Codec != "" {
+				return info, nil
+			}
+			return nil, ErrUnsupportedFormat
+		}
+
+		id := string(chunk[:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, ErrUnsupportedFormat
+			}
+
+			// Only the common part of the format is needed; extensions
+			// are skipped with the rest of the chunk.
+			data := make([]byte, 16)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, fmt.Errorf("failed to read wav fmt chunk: %w", err)
+			}
+
+			info.Codec = wavCodec(binary.LittleEndian.Uint16(data[0:2]))
+			info.Channels = int(binary.LittleEndian.Uint16(data[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+			byteRate = int(binary.LittleEndian.Uint32(data[8:12]))
+			info.Bitrate = byteRate * 8
+			size -= 16
+		case "data":
+			if info.Codec == "" {
+				return nil, ErrUnsupportedFormat
+			}
+			info.Duration = durationOf(size, int64(byteRate))
+			return info, nil
+		}
+
+		// Chunks are word aligned.
+		if size%2 == 1 {
+			size++
+		}
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return nil, fmt.Errorf("failed to skip wav chunk: %w", err)
+		}
+	}
+}
+
+// durationOf returns how long count units last at perSecond units per
+// second, or 0 if that is unknown or beyond maxDuration. It divides before
+// scaling so that large counts cannot overflow.
+func durationOf(count, perSecond int64) time.Duration {
+	if count <= 0 || perSecond <= 0 || count/perSecond >= int64(maxDuration/time.Second) {
+		return 0
+	}
+	return time.Duration(count/perSecond)*time.Second +
+		time.Duration(count%perSecond)*time.Second/time.Duration(perSecond)
+}
+
+// bitrateOf returns the average bitrate of size bytes played over duration,
+// or fallback if the duration is unknown.
+func bitrateOf(size int64, duration time.Duration, fallback int) int {
+	if duration <= 0 {
+		return fallback
+	}
+	return int(float64(size*8) / duration.Seconds())
+}
+
+func wavCodec(format uint16) string {
+	switch format {
+	case 1, 0xfffe:
+		return "pcm"
+	case 3:
+		return "pcm_float"
+	case 6:
+		return "alaw"
+	case 7:
+		return "mulaw"
+	default:
+		return fmt.Sprintf("wav_0x%04x", format)
+	}
+}
@@ -0,0 +1,196 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// mp3Frames repeats a frame header padded to the frame length.
+func mp3Frames(header []byte, length, count int) []byte {
+	frame := make([]byte, length)
+	copy(frame, header)
+	return bytes.Repeat(frame, count)
+}
+
+func wavChunk(id string, size uint32, data []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32([]byte(id), size)
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func wavFormat(format, channels, sampleRate, bitsPerSample int, extension []byte) []byte {
+	blockAlign := channels * bitsPerSample / 8
+	data := binary.LittleEndian.AppendUint16(nil, uint16(format))
+	data = binary.LittleEndian.AppendUint16(data, uint16(channels))
+	data = binary.LittleEndian.AppendUint32(data, uint32(sampleRate))
+	data = binary.LittleEndian.AppendUint32(data, uint32(sampleRate*blockAlign))
+	data = binary.LittleEndian.AppendUint16(data, uint16(blockAlign))
+	data = binary.LittleEndian.AppendUint16(data, uint16(bitsPerSample))
+	return append(data, extension...)
+}
+
+func wavFile(chunks ...[]byte) []byte {
+	body := append([]byte("WAVE"), bytes.Join(chunks, nil)...)
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+func TestProbe(t *testing.T) {
+	// MPEG-1 layer III, 128 kbit/s, 44.1 kHz, joint stereo: 417 byte frames.
+	mpeg1 := []byte{0xff, 0xfb, 0x90, 0x44}
+	// MPEG-2 layer III, 64 kbit/s, 22.05 kHz, mono: 208 byte frames.
+	mpeg2 := []byte{0xff, 0xf3, 0x80, 0xc0}
+
+	xing := make([]byte, 4+32)
+	copy(xing, mpeg1)
+	xing = append(xing, "Xing"...)
+	xing = binary.BigEndian.AppendUint32(xing, 0x01)
+	xing = binary.BigEndian.AppendUint32(xing, 1000)
+
+	vorbisComments := append([]byte("\x03vorbis"), vorbisComment("test")...)
+	opusComments := append([]byte("OpusTags"), vorbisComment("test")...)
+	opus := bytes.Join([][]byte{
+		oggTestPackets(1, 0x02, 0, opusHead(2, 312, 44100)),
+		oggTestPackets(1, 0x00, 0, opusComments),
+		oggTestPackets(1, 0x04, 5*48000+312, make([]byte, 1000)),
+		oggTestPackets(9, 0x04, 1<<40, make([]byte, 16)),
+	}, nil)
+
+	tests := []struct {
+		name string
+		data []byte
+		want Info
+	}{
+		{
+			name: "mp3 constant bitrate",
+			data: mp3Frames(mpeg1, 417, 100),
+			want: Info{Codec: "mp3", Duration: 2606250 * time.Microsecond, Bitrate: 128000, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "mp3 after padding and between id3 tags",
+			data: bytes.Join([][]byte{
+				id3Tag(3, id3Frame(3, "TIT2", 0, latin1Text("Title"))),
+				make([]byte, 100),
+				mp3Frames(mpeg2, 208, 50),
+				id3v1Tag("Title", "", "", "", 0, 0),
+			}, nil),
+			want: Info{Codec: "mp3", Duration: 1300 * time.Millisecond, Bitrate: 64000, SampleRate: 22050, Channels: 1},
+		},
+		{
+			name: "mp3 variable bitrate with a xing header",
+			data: append(mp3Frames(xing, 417, 1), mp3Frames(mpeg1, 417, 9)...),
+			want: Info{Codec: "mp3", Duration: 26122448979, Bitrate: 1277, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "flac",
+			data: append([]byte("fLaC"), bytes.Join([][]byte{
+				flacBlock(false, flacBlockStreamInfo, flacStreamInfo(44100, 2, 16, 441000)),
+				flacBlock(true, 1, make([]byte, 10000-4-38-4)),
+			}, nil)...),
+			want: Info{Codec: "flac", Duration: 10 * time.Second, Bitrate: 8000, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "flac with the largest sample count",
+			data: append([]byte("fLaC"), flacBlock(true, flacBlockStreamInfo, flacStreamInfo(192000, 6, 24, 0xfffffffff))...),
+			want: Info{Codec: "flac", Duration: 357913941328125, SampleRate: 192000, Channels: 6},
+		},
+		{
+			name: "flac claiming more than the longest duration",
+			data: append([]byte("fLaC"), flacBlock(true, flacBlockStreamInfo, flacStreamInfo(8000, 1, 16, 0xfffffffff))...),
+			want: Info{Codec: "flac", SampleRate: 8000, Channels: 1},
+		},
+		{
+			name: "ogg vorbis",
+			data: bytes.Join([][]byte{
+				oggTestPackets(1, 0x02, 0, vorbisIdentification(2, 44100, 128000)),
+				oggTestPackets(1, 0x00, 0, vorbisComments),
+				oggTestPackets(1, 0x00, 220500, make([]byte, 100)),
+				oggTestPackets(1, 0x04, 441000, make([]byte, 100)),
+			}, nil),
+			want: Info{Codec: "vorbis", Duration: 10 * time.Second, Bitrate: 128000, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "ogg opus",
+			data: opus,
+			want: Info{Codec: "opus", Duration: 5 * time.Second, Bitrate: len(opus) * 8 / 5, SampleRate: 48000, Channels: 2},
+		},
+		{
+			name: "ogg opus with a corrupt granule position",
+			data: bytes.Join([][]byte{
+				oggTestPackets(1, 0x02, 0, opusHead(1, 312, 48000)),
+				oggTestPackets(1, 0x04, 1<<62, opusComments),
+			}, nil),
+			want: Info{Codec: "opus", SampleRate: 48000, Channels: 1},
+		},
+		{
+			name: "wav with an extended format and an odd chunk",
+			data: wavFile(
+				wavChunk("fmt ", 18, wavFormat(1, 2, 44100, 16, []byte{0, 0})),
+				wavChunk("LIST", 3, []byte("abc")),
+				wavChunk("data", 44100*4, make([]byte, 64)),
+			),
+			want: Info{Codec: "pcm", Duration: time.Second, Bitrate: 1411200, SampleRate: 44100, Channels: 2},
+		},
+		{
+			name: "wav claiming more than the longest duration",
+			data: wavFile(
+				wavChunk("fmt ", 16, wavFormat(6, 1, 8000, 8, nil)),
+				wavChunk("data", 0xffffffff, make([]byte, 64)),
+			),
+			want: Info{Codec: "alaw", Bitrate: 64000, SampleRate: 8000, Channels: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			got, err := Probe(r)
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("Probe() = %+v, want %+v", *got, tt.want)
+			}
+			if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("reader left at %d, want it rewound", pos)
+			}
+		})
+	}
+}
+
+func TestProbeRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		// want is the error expected, or nil for any read error.
+		want error
+	}{
+		{"text", bytes.Repeat([]byte("this is not an audio file. "), 20), ErrUnsupportedFormat},
+		{"too short", []byte("RIFF"), nil},
+		{"mp3 with a reserved bitrate", mp3Frames([]byte{0xff, 0xfb, 0xf0, 0x44}, 417, 4), ErrUnsupportedFormat},
+		{"flac without stream info", append([]byte("fLaC"), flacBlock(true, flacBlockVorbisComment, vorbisComment("vendor"))...), ErrUnsupportedFormat},
+		{"truncated flac", append([]byte("fLaC"), flacBlock(true, flacBlockStreamInfo, flacStreamInfo(44100, 2, 16, 1))[:20]...), io.ErrUnexpectedEOF},
+		{"ogg of an unknown codec", append(oggTestPackets(1, 0x02, 0, []byte("\x80theora")), make([]byte, 16)...), ErrUnsupportedFormat},
+		{"wav without a format", wavFile(wavChunk("data", 4, make([]byte, 4))), ErrUnsupportedFormat},
+		{"wav with a short format", wavFile(wavChunk("fmt ", 8, make([]byte, 8))), ErrUnsupportedFormat},
+		{"wav with an oversized format", wavFile(wavChunk("fmt ", 0xfffffff0, wavFormat(1, 2, 44100, 16, nil))), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Probe(bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatalf("Probe() = %+v, want an error", *got)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Probe() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
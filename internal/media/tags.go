@@ -0,0 +1,139 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Tags struct {
+	Title       string
+	Artist      string
+	Album       string
+	Genre       string
+	TrackNumber int
+	Year        int
+	Duration    time.Duration
+	Picture     *Picture
+}
+
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// ReadTags extracts embedded metadata from an ID3v1/ID3v2 tagged MP3, a FLAC
+// file or an Ogg Vorbis/Opus stream. Fields missing from the file are left
+// empty. r is rewound before returning.
+func ReadTags(r io.ReadSeeker) (*Tags, error) {
+	defer r.Seek(0, io.SeekStart)
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	tags := &Tags{}
+	var err error
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		err = readID3v2(r, tags)
+		if err == nil {
+			err = readID3v1(r, tags)
+		}
+	case bytes.Equal(magic, []byte("fLaC")):
+		err = readFLAC(r, tags)
+	case bytes.Equal(magic, []byte("OggS")):
+		err = readOgg(r, tags)
+	default:
+		err = readID3v1(r, tags)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// setVorbisComment maps a Vorbis comment field, as used by FLAC and Ogg, onto tags.
+func (t *Tags) setVorbisComment(field string) {
+	key, value, ok := strings.Cut(field, "=")
+	if !ok {
+		return
+	}
+
+	value = strings.TrimSpace(value)
+	switch strings.ToUpper(key) {
+	case "TITLE":
+		setString(&t.Title, value)
+	case "ARTIST":
+		setString(&t.Artist, value)
+	case "ALBUM":
+		setString(&t.Album, value)
+	case "GENRE":
+		setString(&t.Genre, value)
+	case "TRACKNUMBER":
+		setInt(&t.TrackNumber, parseNumber(value))
+	case "DATE", "YEAR":
+		setInt(&t.Year, parseNumber(value))
+	case "METADATA_BLOCK_PICTURE":
+		if t.Picture == nil {
+			t.Picture = parseEncodedFLACPicture(value)
+		}
+	}
+}
+
+// readBlock reads a block of n bytes whose size is declared by the file
+// itself. The buffer grows with the data actually read instead of being
+// allocated up front, so a corrupt size cannot claim more memory than the
+// upload it came from.
+func readBlock(r io.Reader, n int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+func setString(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+func setInt(dst *int, value int) {
+	if *dst == 0 {
+		*dst = value
+	}
+}
+
+// parseNumber reads the leading digits of values such as "3/12" or "1999-05-01".
+func parseNumber(value string) int {
+	value = strings.TrimSpace(value)
+	end := 0
+	for end < len(value) && value[end] >= '0' && value[end] <= '9' {
+		end++
+	}
+
+	n, err := strconv.Atoi(value[:end])
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,371 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// The builders below assemble the smallest byte streams the readers accept,
+// so that each fixture shows exactly which bytes a case depends on.
+
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+func id3Frame(version byte, id string, flags uint16, body []byte) []byte {
+	var frame []byte
+	switch version {
+	case 2:
+		n := len(body)
+		frame = append([]byte(id), byte(n>>16), byte(n>>8), byte(n))
+	case 3:
+		frame = binary.BigEndian.AppendUint32([]byte(id), uint32(len(body)))
+		frame = binary.BigEndian.AppendUint16(frame, flags)
+	default:
+		frame = append([]byte(id), syncsafeBytes(len(body))...)
+		frame = binary.BigEndian.AppendUint16(frame, flags)
+	}
+	return append(frame, body...)
+}
+
+func id3Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	tag := append([]byte{'I', 'D', '3', version, 0, 0}, syncsafeBytes(len(body))...)
+	return append(tag, body...)
+}
+
+func latin1Text(s string) []byte {
+	return append([]byte{0}, s...)
+}
+
+func id3v1Tag(title, artist, album, year string, track, genre byte) []byte {
+	field := func(s string, n int) []byte {
+		b := make([]byte, n)
+		copy(b, s)
+		return b
+	}
+
+	tag := []byte("TAG")
+	tag = append(tag, field(title, 30)...)
+	tag = append(tag, field(artist, 30)...)
+	tag = append(tag, field(album, 30)...)
+	tag = append(tag, field(year, 4)...)
+	tag = append(tag, make([]byte, 28)...)
+	return append(tag, 0, track, genre)
+}
+
+func flacBlock(last bool, blockType byte, data []byte) []byte {
+	if last {
+		blockType |= 0x80
+	}
+	n := len(data)
+	return append([]byte{blockType, byte(n >> 16), byte(n >> 8), byte(n)}, data...)
+}
+
+func flacStreamInfo(sampleRate, channels, bitsPerSample int, totalSamples int64) []byte {
+	info := make([]byte, 34)
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bitsPerSample-1)<<36 | uint64(totalSamples)
+	binary.BigEndian.PutUint64(info[10:18], packed)
+	return info
+}
+
+func vorbisComment(vendor string, fields ...string) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(vendor)))
+	data = append(data, vendor...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(fields)))
+	for _, field := range fields {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(field)))
+		data = append(data, field...)
+	}
+	return data
+}
+
+func flacPicture(mime string, picture []byte) []byte {
+	data := binary.BigEndian.AppendUint32(nil, 3)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(mime)))
+	data = append(data, mime...)
+	data = binary.BigEndian.AppendUint32(data, 0)
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(picture)))
+	return append(data, picture...)
+}
+
+// oggTestPage builds a page holding the given segments. Complete packets are
+// laced with oggLacing; a packet split across pages is laced by hand.
+func oggTestPage(serial uint32, headerType byte, granule int64, lacing []byte, data []byte) []byte {
+	page := []byte("OggS")
+	page = append(page, 0, headerType)
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, serial)
+	page = append(page, make([]byte, 8)...) // sequence number and checksum
+	page = append(page, byte(len(lacing)))
+	page = append(page, lacing...)
+	return append(page, data...)
+}
+
+func oggTestPackets(serial uint32, headerType byte, granule int64, packets ...[]byte) []byte {
+	var lacing []byte
+	for _, packet := range packets {
+		lacing = append(lacing, oggLacing(len(packet))...)
+	}
+	return oggTestPage(serial, headerType, granule, lacing, bytes.Join(packets, nil))
+}
+
+func oggLacing(n int) []byte {
+	lacing := bytes.Repeat([]byte{255}, n/255)
+	return append(lacing, byte(n%255))
+}
+
+func vorbisIdentification(channels, sampleRate, nominalBitrate int) []byte {
+	packet := []byte("\x01vorbis")
+	packet = binary.LittleEndian.AppendUint32(packet, 0)
+	packet = append(packet, byte(channels))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(sampleRate))
+	packet = binary.LittleEndian.AppendUint32(packet, 0)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(nominalBitrate))
+	packet = binary.LittleEndian.AppendUint32(packet, 0)
+	return append(packet, 0xb8, 1)
+}
+
+func opusHead(channels, preSkip, inputSampleRate int) []byte {
+	packet := []byte("OpusHead")
+	packet = append(packet, 1, byte(channels))
+	packet = binary.LittleEndian.AppendUint16(packet, uint16(preSkip))
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(inputSampleRate))
+	return append(packet, 0, 0, 0)
+}
+
+func TestReadTags(t *testing.T) {
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe0, 'J', 'F', 'I', 'F'}
+	utf16Artist := []byte{1, 0xff, 0xfe, 'B', 0, 0xe9, 0, 'r', 0, 'e', 0, 0, 0}
+	apic := append([]byte("\x00image/jpg\x00\x03cover\x00"), jpeg...)
+	pic := append([]byte("\x00PNG\x03\x00"), jpeg...)
+	longComment := "COMMENT=" + string(bytes.Repeat([]byte("x"), 300))
+	oggComments := append([]byte("\x03vorbis"), vorbisComment("test", "TITLE=Night Drive", longComment, "ARTIST=Kavinsky")...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *Tags
+		wantErr bool
+	}{
+		{
+			name: "id3v2.3",
+			data: id3Tag(3,
+				id3Frame(3, "TIT2", 0, latin1Text("Caf\xe9 Song")),
+				id3Frame(3, "TPE1", 0, utf16Artist),
+				id3Frame(3, "TALB", 0, []byte("\x03Ålbum\x00")),
+				id3Frame(3, "TCON", 0, latin1Text("(17)")),
+				id3Frame(3, "TRCK", 0, latin1Text("3/12")),
+				id3Frame(3, "TYER", 0, latin1Text("1999")),
+				id3Frame(3, "TLEN", 0, latin1Text("215000")),
+				id3Frame(3, "APIC", 0, apic),
+			),
+			want: &Tags{
+				Title:       "Café Song",
+				Artist:      "Bére",
+				Album:       "Ålbum",
+				Genre:       "Rock",
+				TrackNumber: 3,
+				Year:        1999,
+				Duration:    215 * time.Second,
+				Picture:     &Picture{MIMEType: "image/jpeg", Data: jpeg},
+			},
+		},
+		{
+			name: "id3v2.2",
+			data: id3Tag(2,
+				id3Frame(2, "TT2", 0, latin1Text("Old Title")),
+				id3Frame(2, "TCO", 0, latin1Text("(8)Bebop")),
+				id3Frame(2, "PIC", 0, pic),
+			),
+			want: &Tags{
+				Title:   "Old Title",
+				Genre:   "Bebop",
+				Picture: &Picture{MIMEType: "image/png", Data: jpeg},
+			},
+		},
+		{
+			name: "id3v2.4 with data length indicator",
+			data: id3Tag(4,
+				id3Frame(4, "TIT2", 0x0001, append(syncsafeBytes(6), latin1Text("Title")...)),
+				id3Frame(4, "TDRC", 0, latin1Text("2021-06-01")),
+			),
+			want: &Tags{Title: "Title", Year: 2021},
+		},
+		{
+			name: "id3v2.3 skips compressed frames",
+			data: id3Tag(3,
+				id3Frame(3, "TIT2", 0x0080, latin1Text("Compressed")),
+				id3Frame(3, "TALB", 0, latin1Text("Album")),
+			),
+			want: &Tags{Album: "Album"},
+		},
+		{
+			name: "id3v2 stops at padding",
+			data: id3Tag(3,
+				id3Frame(3, "TIT2", 0, latin1Text("Title")),
+				make([]byte, 20),
+				id3Frame(3, "TALB", 0, latin1Text("After Padding")),
+			),
+			want: &Tags{Title: "Title"},
+		},
+		{
+			name: "id3v2 frame larger than the tag",
+			data: id3Tag(3,
+				id3Frame(3, "TIT2", 0, latin1Text("Title")),
+				id3Frame(3, "TPE1", 0, latin1Text("Artist"))[:14],
+			),
+			want: &Tags{Title: "Title"},
+		},
+		{
+			name: "id3v2 falls back to id3v1",
+			data: append(
+				id3Tag(3, id3Frame(3, "TIT2", 0, latin1Text("V2 Title"))),
+				id3v1Tag("V1 Title", "V1 Artist", "V1 Album", "1987", 7, 13)...,
+			),
+			want: &Tags{Title: "V2 Title", Artist: "V1 Artist", Album: "V1 Album", Genre: "Pop", TrackNumber: 7, Year: 1987},
+		},
+		{
+			name: "id3v1 only",
+			data: append(bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 64), id3v1Tag("Title", "Artist", "", "", 0, 255)...),
+			want: &Tags{Title: "Title", Artist: "Artist"},
+		},
+		{
+			name:    "truncated id3v2 tag",
+			data:    id3Tag(3, id3Frame(3, "TIT2", 0, latin1Text("Title")))[:20],
+			wantErr: true,
+		},
+		{
+			name: "flac",
+			data: append([]byte("fLaC"), bytes.Join([][]byte{
+				flacBlock(false, flacBlockStreamInfo, flacStreamInfo(44100, 2, 16, 441000)),
+				flacBlock(false, flacBlockVorbisComment, vorbisComment("reference libFLAC 1.4.3",
+					"title=Lullaby", "ARTIST=Someone", "ALBUM=Nights", "GENRE=Ambient", "TRACKNUMBER=05/10", "DATE=2001-03-04", "BROKEN")),
+				flacBlock(true, flacBlockPicture, flacPicture("image/jpeg", jpeg)),
+			}, nil)...),
+			want: &Tags{
+				Title:       "Lullaby",
+				Artist:      "Someone",
+				Album:       "Nights",
+				Genre:       "Ambient",
+				TrackNumber: 5,
+				Year:        2001,
+				Picture:     &Picture{MIMEType: "image/jpeg", Data: jpeg},
+			},
+		},
+		{
+			name: "flac comment count larger than the block",
+			data: append([]byte("fLaC"), flacBlock(true, flacBlockVorbisComment,
+				vorbisComment("vendor", "TITLE=Only", "ARTIST=Cut")[:36])...),
+			want: &Tags{Title: "Only"},
+		},
+		{
+			name: "flac picture with a bad length",
+			data: append([]byte("fLaC"), flacBlock(true, flacBlockPicture, flacPicture("image/png", jpeg)[:30])...),
+			want: &Tags{},
+		},
+		{
+			name:    "truncated flac block",
+			data:    append([]byte("fLaC"), flacBlock(true, flacBlockVorbisComment, vorbisComment("vendor", "TITLE=x"))[:12]...),
+			wantErr: true,
+		},
+		{
+			name: "ogg vorbis with a comment packet across pages",
+			data: bytes.Join([][]byte{
+				oggTestPackets(1, 0x02, 0, vorbisIdentification(2, 44100, 128000)),
+				oggTestPage(7, 0x02, 0, oggLacing(5), []byte("other")),
+				oggTestPage(1, 0x00, 0, []byte{255}, oggComments[:255]),
+				oggTestPage(1, 0x01, 0, oggLacing(len(oggComments)-255), oggComments[255:]),
+			}, nil),
+			want: &Tags{Title: "Night Drive", Artist: "Kavinsky"},
+		},
+		{
+			name: "ogg opus with an embedded picture",
+			data: bytes.Join([][]byte{
+				oggTestPackets(1, 0x02, 0, opusHead(2, 312, 48000)),
+				oggTestPackets(1, 0x00, 0, append([]byte("OpusTags"), vorbisComment("libopus",
+					"TITLE=Opus Song",
+					"METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(flacPicture("image/png", jpeg)),
+				)...)),
+			}, nil),
+			want: &Tags{Title: "Opus Song", Picture: &Picture{MIMEType: "image/png", Data: jpeg}},
+		},
+		{
+			name: "ogg stream ending before the comments",
+			data: oggTestPackets(1, 0x02, 0, opusHead(2, 312, 48000)),
+			want: &Tags{},
+		},
+		{
+			name: "ogg with a corrupt second page",
+			data: append(
+				oggTestPackets(1, 0x02, 0, opusHead(2, 312, 48000)),
+				bytes.Repeat([]byte("junk"), 10)...,
+			),
+			wantErr: true,
+		},
+		{
+			name: "untagged file",
+			data: append([]byte("RIFF\x24\x00\x00\x00WAVE"), make([]byte, 200)...),
+			want: &Tags{},
+		},
+		{
+			name:    "too short",
+			data:    []byte("ID"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.data)
+			got, err := ReadTags(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ReadTags() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadTags() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadTags() = %+v, want %+v", got, tt.want)
+			}
+			if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+				t.Errorf("reader left at %d, want it rewound", pos)
+			}
+		})
+	}
+}
+
+// TestReadTagsDeclaredSize checks that a tag claiming far more data than the
+// file holds fails without allocating what it claims.
+func TestReadTagsDeclaredSize(t *testing.T) {
+	tests := map[string][]byte{
+		"id3v2": append([]byte{'I', 'D', '3', 3, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f}, make([]byte, 64)...),
+		"flac":  append([]byte("fLaC"), 0x84, 0xff, 0xff, 0xff, 'x', 'y'),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, err := ReadTags(bytes.NewReader(data))
+			runtime.ReadMemStats(&after)
+
+			if err == nil {
+				t.Fatal("ReadTags() succeeded on a truncated tag")
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Errorf("ReadTags() allocated %d bytes for a %d byte file", allocated, len(data))
+			}
+		})
+	}
+}
@@ -1,33 +1,105 @@
 package middleware
 
 import (
+	"context"
 	"music-hosting/internal/auth"
+	"music-hosting/internal/http/problem"
+	"music-hosting/internal/models"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Auth() gin.HandlerFunc {
+// SessionChecker reports whether the session an access token was issued
+// for is still active.
+type SessionChecker interface {
+	IsSessionActive(ctx context.Context, sessionID int) (bool, error)
+}
+
+type TokenValidator interface {
+	ValidateToken(tokenString string) (*auth.Claims, error)
+}
+
+func Auth(tokens TokenValidator, sessions SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 
 		if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
-			c.Abort()
+			problem.Respond(c, http.StatusUnauthorized, "Missing or invalid token")
 			return
 		}
 
 		tokenString = tokenString[len("Bearer "):]
 
-		userID, err := auth.ValidateToken(tokenString)
+		claims, err := tokens.ValidateToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+			problem.Respond(c, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+
+		active, err := sessions.IsSessionActive(c.Request.Context(), claims.SessionID)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "Failed to verify session")
+			return
+		}
+
+		if !active {
+			problem.Respond(c, http.StatusUnauthorized, "Session has been revoked")
+			return
+		}
+
+		role := claims.Role
+		if role == "" {
+			role = models.RoleListener
+		}
+
+		c.Set("userID", claims.UserID)
+		c.Set("role", role)
+		c.Set("sessionID", claims.SessionID)
+		c.Next()
+	}
+}
+
+// RequireRole rejects requests whose authenticated user has none of the
+// given roles. It must run after Auth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentUser(c)
+		if !ok {
+			problem.Respond(c, http.StatusUnauthorized, "User not authorized")
 			return
 		}
 
-		c.Set("userID", userID)
+		if !slices.Contains(roles, principal.Role) {
+			problem.Respond(c, http.StatusForbidden, "Access denied")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user stored in the context by Auth.
+func CurrentUser(c *gin.Context) (*models.Principal, bool) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		return nil, false
+	}
+
+	return &models.Principal{
+		UserID:    userID.(int),
+		Role:      c.GetString("role"),
+		SessionID: c.GetInt("sessionID"),
+	}, true
+}
+
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
 		c.Next()
 	}
 }
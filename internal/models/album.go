@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ReleaseDateLayout is the format of album release dates in requests and
+// responses.
+const ReleaseDateLayout = "2006-01-02"
+
+type Album struct {
+	ID          int
+	Title       string
+	ArtistID    int
+	ArtistName  string
+	ReleaseDate *time.Time
+	CoverKey    string
+	OwnerID     int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type AlbumRequest struct {
+	Title       string `json:"title"`
+	ArtistID    int    `json:"artist_id"`
+	ReleaseDate string `json:"release_date"`
+}
+
+type AlbumResponse struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	ArtistID    int       `json:"artist_id,omitempty"`
+	ArtistName  string    `json:"artist_name,omitempty"`
+	ReleaseDate string    `json:"release_date,omitempty"`
+	CoverURL    string    `json:"cover_url,omitempty"`
+	OwnerID     int       `json:"owner_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	CreditPrimary  = "primary"
+	CreditFeatured = "featured"
+	CreditRemixer  = "remixer"
+)
+
+type Artist struct {
+	ID        int
+	Name      string
+	OwnerID   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type ArtistRequest struct {
+	Name string `json:"name"`
+}
+
+type ArtistResponse struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   int       `json:"owner_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
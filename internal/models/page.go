@@ -0,0 +1,29 @@
+package models
+
+// PageRequest selects a page of a list. Cursor is empty for the first page
+// and otherwise one of the cursors of a previous Page.
+type PageRequest struct {
+	Cursor string
+	Limit  int
+	// Total asks for the number of items in the whole list, which costs an
+	// extra query.
+	Total bool
+}
+
+// Page is a slice of a list ordered by a unique key. Next and Prev are
+// opaque cursors to the neighbouring pages and are empty at either end.
+type Page[T any] struct {
+	Items []T
+	Next  string
+	Prev  string
+	Total *int
+}
+
+// ListResponse is the envelope of every paginated list. Next and Prev are
+// links to the neighbouring pages.
+type ListResponse[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Total *int   `json:"total,omitempty"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "encoding/json"
+
+// Field is a member of a JSON Merge Patch document (RFC 7396). Set reports
+// whether the member was present at all and Null whether it was null, which
+// asks for the value to be removed.
+type Field[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (f *Field[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if string(data) == "null" {
+		f.Null = true
+		return nil
+	}
+
+	return json.Unmarshal(data, &f.Value)
+}
+
+type UserPatch struct {
+	Login Field[string] `json:"login"`
+	Email Field[string] `json:"email"`
+}
+
+type TrackPatch struct {
+	Name        Field[string] `json:"name"`
+	Artist      Field[string] `json:"artist"`
+	URL         Field[string] `json:"url"`
+	Album       Field[string] `json:"album"`
+	TrackNumber Field[int]    `json:"track_number"`
+	Year        Field[int]    `json:"year"`
+	Genre       Field[string] `json:"genre"`
+	AlbumID     Field[int]    `json:"album_id"`
+	DiscNumber  Field[int]    `json:"disc_number"`
+}
+
+type PlaylistPatch struct {
+	Name     Field[string] `json:"name"`
+	TrackIDs Field[[]int]  `json:"tracks_id"`
+}
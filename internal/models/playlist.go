@@ -3,12 +3,15 @@ package models
 import "time"
 
 type Playlist struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	UserID    int       `json:"user_id"`
-	Tracks    []*Track  `json:"tracks"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              int              `json:"id"`
+	Name            string           `json:"name"`
+	UserID          int              `json:"user_id"`
+	Tracks          []*Track         `json:"tracks"`
+	Entries         []*PlaylistEntry `json:"entries"`
+	TotalDurationMs int              `json:"total_duration_ms"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	Version         int              `json:"version"`
 }
 
 type CreatePlaylistRequest struct {
@@ -24,10 +27,38 @@ type UpdatePlaylistRequest struct {
 }
 
 type PlaylistResponse struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	UserID    int       `json:"user_id"`
-	Tracks    []*Track  `json:"tracks"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              int              `json:"id"`
+	Name            string           `json:"name"`
+	UserID          int              `json:"user_id"`
+	Tracks          []TrackResponse  `json:"tracks"`
+	Entries         []*PlaylistEntry `json:"entries"`
+	TotalDurationMs int              `json:"total_duration_ms"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	Version         int              `json:"version"`
+}
+
+// PlaylistEntry is one occurrence of a track in a playlist. Entries are
+// addressed by ID so that copies of the same track can be told apart.
+type PlaylistEntry struct {
+	ID       int `json:"id"`
+	Position int `json:"position"`
+	TrackID  int `json:"track_id"`
+}
+
+// InsertPlaylistTracksRequest adds tracks before the entry at Position, or
+// at the end of the playlist if Position is omitted.
+type InsertPlaylistTracksRequest struct {
+	TrackIDs []int `json:"tracks_id"`
+	Position *int  `json:"position"`
+}
+
+// MovePlaylistTracksRequest moves RangeLength entries starting at
+// RangeStart so that they come before the entry that was at InsertBefore.
+// An InsertBefore equal to the number of entries moves them to the end. A
+// missing RangeLength moves a single entry.
+type MovePlaylistTracksRequest struct {
+	RangeStart   int `json:"range_start"`
+	RangeLength  int `json:"range_length"`
+	InsertBefore int `json:"insert_before"`
 }
@@ -0,0 +1,25 @@
+package models
+
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+type Reaction struct {
+	UserID   int
+	TrackID  int
+	Value    string
+	Likes    int
+	Dislikes int
+}
+
+type ReactionRequest struct {
+	Value string `json:"value"`
+}
+
+type ReactionResponse struct {
+	TrackID  int    `json:"track_id"`
+	Value    string `json:"value,omitempty"`
+	Likes    int    `json:"likes"`
+	Dislikes int    `json:"dislikes"`
+}
@@ -0,0 +1,97 @@
+package models
+
+// Sections of a search response. Clients pick them with the type parameter.
+const (
+	SearchTracks    = "tracks"
+	SearchArtists   = "artists"
+	SearchAlbums    = "albums"
+	SearchPlaylists = "playlists"
+)
+
+var SearchTypes = []string{SearchTracks, SearchArtists, SearchAlbums, SearchPlaylists}
+
+// SearchHit is a search result with its relevance and its name, escaped as
+// HTML with the matched terms wrapped in <mark> tags.
+type SearchHit[T any] struct {
+	Item      T
+	Score     float64
+	Highlight string
+}
+
+// SearchResults holds the best matches of each requested type. Sections
+// that were not requested are nil.
+type SearchResults struct {
+	Tracks    []*SearchHit[*Track]
+	Artists   []*SearchHit[*Artist]
+	Albums    []*SearchHit[*Album]
+	Playlists []*SearchHit[*Playlist]
+}
+
+type TrackHitResponse struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Artist     string    `json:"artist"`
+	Album      string    `json:"album,omitempty"`
+	AlbumID    int       `json:"album_id,omitempty"`
+	DurationMs int       `json:"duration_ms,omitempty"`
+	Artists    []*Credit `json:"artists"`
+	Highlight  string    `json:"highlight"`
+	Score      float64   `json:"score"`
+}
+
+type ArtistHitResponse struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	Highlight string  `json:"highlight"`
+	Score     float64 `json:"score"`
+}
+
+type AlbumHitResponse struct {
+	ID         int     `json:"id"`
+	Title      string  `json:"title"`
+	ArtistID   int     `json:"artist_id,omitempty"`
+	ArtistName string  `json:"artist_name,omitempty"`
+	Highlight  string  `json:"highlight"`
+	Score      float64 `json:"score"`
+}
+
+type PlaylistHitResponse struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	UserID    int     `json:"user_id"`
+	Highlight string  `json:"highlight"`
+	Score     float64 `json:"score"`
+}
+
+type SearchResponse struct {
+	Tracks    *[]TrackHitResponse    `json:"tracks,omitempty"`
+	Artists   *[]ArtistHitResponse   `json:"artists,omitempty"`
+	Albums    *[]AlbumHitResponse    `json:"albums,omitempty"`
+	Playlists *[]PlaylistHitResponse `json:"playlists,omitempty"`
+}
+
+// Suggestions complete a partially typed search, shortest completions first.
+type Suggestions struct {
+	Tracks    []*Suggestion
+	Artists   []*Suggestion
+	Playlists []*Suggestion
+}
+
+// Suggestion is a name that starts with the typed text. ID refers to the
+// track, artist or playlist it names and is zero for artists that are only
+// known from track metadata.
+type Suggestion struct {
+	ID   int
+	Text string
+}
+
+type SuggestionResponse struct {
+	ID   int    `json:"id,omitempty"`
+	Text string `json:"text"`
+}
+
+type SuggestResponse struct {
+	Tracks    []SuggestionResponse `json:"tracks"`
+	Artists   []SuggestionResponse `json:"artists"`
+	Playlists []SuggestionResponse `json:"playlists"`
+}
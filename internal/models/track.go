@@ -1,27 +1,108 @@
 package models
 
+import "time"
+
 type Track struct {
-	ID       int
-	Name     string
-	Artist   string
-	URL      string
-	Likes    int
-	Dislikes int
+	ID          int
+	OwnerID     int
+	Name        string
+	Artist      string
+	URL         string
+	Likes       int
+	Dislikes    int
+	StorageKey  string
+	Size        int64
+	MimeType    string
+	Checksum    string
+	Album       string
+	TrackNumber int
+	Year        int
+	Genre       string
+	DurationMs  int
+	CoverKey    string
+	Bitrate     int
+	Codec       string
+	SampleRate  int
+	Channels    int
+	AlbumID     int
+	DiscNumber  int
+	Artists     []*Credit
+	Plays       int
+	CreatedAt   time.Time
+	Version     int
+}
+
+// TrackFilter narrows down and orders a track listing. Zero fields are
+// ignored.
+type TrackFilter struct {
+	Name          string
+	Artist        string
+	ArtistID      int
+	AlbumID       int
+	PlaylistID    int
+	Genre         string
+	MinLikes      int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// DurationGt and DurationLt bound the duration in milliseconds.
+	DurationGt int
+	DurationLt int
+	// Sort is one of TrackSorts, prefixed with "-" for descending order.
+	Sort string
 }
 
+// TrackSorts are the orders a track listing can be sorted in.
+var TrackSorts = []string{"name", "artist", "likes", "created_at", "duration", "plays"}
+
 type TrackRequest struct {
-	Name     string `json:"name"`
-	Artist   string `json:"artist"`
-	URL      string `json:"url"`
-	Likes    int    `json:"likes"`
-	Dislikes int    `json:"dislikes"`
+	Name        string `json:"name" form:"name"`
+	Artist      string `json:"artist" form:"artist"`
+	URL         string `json:"url"`
+	Album       string `json:"album" form:"album"`
+	TrackNumber int    `json:"track_number" form:"track_number"`
+	Year        int    `json:"year" form:"year"`
+	Genre       string `json:"genre" form:"genre"`
+	AlbumID     int    `json:"album_id" form:"album_id"`
+	DiscNumber  int    `json:"disc_number" form:"disc_number"`
 }
 
 type TrackResponse struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Artist   string `json:"artist"`
-	URL      string `json:"url"`
-	Likes    int    `json:"likes"`
-	Dislikes int    `json:"dislikes"`
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"owner_id,omitempty"`
+	Name        string    `json:"name"`
+	Artist      string    `json:"artist"`
+	URL         string    `json:"url"`
+	Likes       int       `json:"likes"`
+	Dislikes    int       `json:"dislikes"`
+	Size        int64     `json:"size,omitempty"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	Checksum    string    `json:"checksum,omitempty"`
+	Album       string    `json:"album,omitempty"`
+	TrackNumber int       `json:"track_number,omitempty"`
+	Year        int       `json:"year,omitempty"`
+	Genre       string    `json:"genre,omitempty"`
+	DurationMs  int       `json:"duration_ms,omitempty"`
+	Bitrate     int       `json:"bitrate,omitempty"`
+	Codec       string    `json:"codec,omitempty"`
+	SampleRate  int       `json:"sample_rate,omitempty"`
+	Channels    int       `json:"channels,omitempty"`
+	CoverURL    string    `json:"cover_url,omitempty"`
+	AlbumID     int       `json:"album_id,omitempty"`
+	DiscNumber  int       `json:"disc_number,omitempty"`
+	Artists     []*Credit `json:"artists"`
+	Plays       int       `json:"plays"`
+	CreatedAt   time.Time `json:"created_at"`
+	Version     int       `json:"version"`
+}
+
+// Credit names an artist of a track and the part they played in it.
+type Credit struct {
+	ArtistID int    `json:"artist_id"`
+	Name     string `json:"name,omitempty"`
+	Role     string `json:"role"`
+}
+
+// SetCreditsRequest replaces the artists credited on a track.
+type SetCreditsRequest struct {
+	Artists []*Credit `json:"artists"`
 }
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type TwoFactorEnrollment struct {
+	Secret        string
+	URI           string
+	RecoveryCodes []string
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// LoginResult holds either a token pair or, for accounts with two-factor
+// authentication, a challenge token to exchange for one.
+type LoginResult struct {
+	Tokens             *Tokens
+	ChallengeToken     string
+	ChallengeExpiresIn time.Duration
+}
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
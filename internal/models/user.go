@@ -1,11 +1,18 @@
 package models
 
+const (
+	RoleAdmin    = "admin"
+	RoleArtist   = "artist"
+	RoleListener = "listener"
+)
+
 type User struct {
 	ID       int
 	Login    string
 	Email    string
 	Password string
 	Sale     string
+	Role     string
 }
 
 type UserRequest struct {
@@ -15,8 +22,52 @@ type UserRequest struct {
 	Password string `json:"password"`
 }
 
+type UpdateUserRequest struct {
+	Login string `json:"login"`
+	Email string `json:"email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
 type UserResponse struct {
 	ID    int    `json:"id"`
 	Login string `json:"login"`
 	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Principal is the authenticated user a request is made on behalf of.
+type Principal struct {
+	UserID    int
+	Role      string
+	SessionID int
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+// CanModify reports whether p may change a resource owned by ownerID.
+func (p *Principal) CanModify(ownerID int) bool {
+	return p.IsAdmin() || p.UserID == ownerID
 }
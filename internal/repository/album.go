@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+)
+
+type AlbumStorage struct {
+	db *sql.DB
+}
+
+func NewAlbumStorage(db *sql.DB) (*AlbumStorage, error) {
+	return &AlbumStorage{db: db}, nil
+}
+
+const albumColumns = `al.id, al.title, COALESCE(al.artist_id, 0), COALESCE(ar.name, ''), al.release_date,
+	COALESCE(al.cover_key, ''), COALESCE(al.owner_id, 0), al.created_at, al.updated_at`
+
+const albumFrom = ` FROM albums al LEFT JOIN artists ar ON ar.id = al.artist_id`
+
+// scanAlbum reads the columns in albumColumns. Columns selected after them
+// are scanned into extra.
+func scanAlbum(row rowScanner, extra ...interface{}) (*Album, error) {
+	album := &Album{}
+	dest := []interface{}{
+		&album.ID,
+		&album.Title,
+		&album.ArtistID,
+		&album.ArtistName,
+		&album.ReleaseDate,
+		&album.CoverKey,
+		&album.OwnerID,
+		&album.CreatedAt,
+		&album.UpdatedAt,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return album, nil
+}
+
+func (s *AlbumStorage) Create(ctx context.Context, album *Album) (int, error) {
+	const query = `
+		INSERT INTO albums (title, artist_id, release_date, cover_key, owner_id, created_at, updated_at)
+		VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''), NULLIF($5, 0), $6, $7)
+		RETURNING id`
+
+	var id int
+	err := conn(ctx, s.db).QueryRowContext(
+		ctx,
+		query,
+		album.Title,
+		album.ArtistID,
+		album.ReleaseDate,
+		album.CoverKey,
+		album.OwnerID,
+		album.CreatedAt,
+		album.UpdatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, mapError(err)
+	}
+
+	return id, nil
+}
+
+func (s *AlbumStorage) Get(ctx context.Context, id int) (*Album, error) {
+	const query = `SELECT ` + albumColumns + albumFrom + ` WHERE al.id = $1`
+
+	album, err := scanAlbum(conn(ctx, s.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("album")
+		}
+		return nil, err
+	}
+
+	return album, nil
+}
+
+// GetByTitle returns the oldest album of artistID whose title matches title
+// regardless of case. An artistID of 0 matches albums without an artist.
+func (s *AlbumStorage) GetByTitle(ctx context.Context, artistID int, title string) (*Album, error) {
+	const query = `SELECT ` + albumColumns + albumFrom + `
+		WHERE lower(al.title) = lower($1) AND COALESCE(al.artist_id, 0) = $2
+		ORDER BY al.id LIMIT 1`
+
+	album, err := scanAlbum(conn(ctx, s.db).QueryRowContext(ctx, query, title, artistID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("album")
+		}
+		return nil, err
+	}
+
+	return album, nil
+}
+
+// albumKeys orders albums newest release first. Albums without a release
+// date come last.
+var albumKeys = keyset{
+	{expr: "COALESCE(al.release_date, DATE '-infinity')", desc: true},
+	{expr: "al.id", desc: true},
+}
+
+// GetAlbums returns a page of the albums, newest release first, optionally
+// only those of artistID or whose title contains title.
+func (s *AlbumStorage) GetAlbums(ctx context.Context, artistID int, title string, page *models.PageRequest) (*models.Page[*Album], error) {
+	q := listQuery{columns: albumColumns, from: albumFrom}
+
+	if artistID > 0 {
+		q.filter("al.artist_id = ?", artistID)
+	}
+
+	if title != "" {
+		q.filter("al.title ILIKE ?", "%"+escapeLike(title)+"%")
+	}
+
+	return queryPage(ctx, conn(ctx, s.db), q, albumKeys, page, scanAlbum)
+}
+
+func (s *AlbumStorage) Update(ctx context.Context, album *Album) error {
+	const query = `
+		UPDATE albums SET title = $1, artist_id = NULLIF($2, 0), release_date = $3, updated_at = $4
+		WHERE id = $5`
+
+	result, err := conn(ctx, s.db).ExecContext(
+		ctx,
+		query,
+		album.Title,
+		album.ArtistID,
+		album.ReleaseDate,
+		album.UpdatedAt,
+		album.ID,
+	)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return requireRow(result, "album")
+}
+
+func (s *AlbumStorage) UpdateCover(ctx context.Context, id int, coverKey string) error {
+	const query = `UPDATE albums SET cover_key = NULLIF($1, ''), updated_at = NOW() WHERE id = $2`
+
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, coverKey, id)
+	if err != nil {
+		return err
+	}
+
+	return requireRow(result, "album")
+}
+
+func (s *AlbumStorage) Delete(ctx context.Context, id int) error {
+	const query = `DELETE FROM albums WHERE id = $1`
+
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return requireRow(result, "album")
+}
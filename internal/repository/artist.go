@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+
+	"github.com/lib/pq"
+)
+
+type ArtistStorage struct {
+	db *sql.DB
+}
+
+func NewArtistStorage(db *sql.DB) (*ArtistStorage, error) {
+	return &ArtistStorage{db: db}, nil
+}
+
+const artistColumns = `id, name, COALESCE(owner_id, 0), created_at, updated_at`
+
+// scanArtist reads the columns in artistColumns. Columns selected after
+// them are scanned into extra.
+func scanArtist(row rowScanner, extra ...interface{}) (*Artist, error) {
+	artist := &Artist{}
+	dest := []interface{}{
+		&artist.ID,
+		&artist.Name,
+		&artist.OwnerID,
+		&artist.CreatedAt,
+		&artist.UpdatedAt,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return artist, nil
+}
+
+func (s *ArtistStorage) Create(ctx context.Context, artist *Artist) (int, error) {
+	const query = `
+		INSERT INTO artists (name, owner_id, created_at, updated_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+		RETURNING id`
+
+	var id int
+	err := conn(ctx, s.db).QueryRowContext(
+		ctx,
+		query,
+		artist.Name,
+		artist.OwnerID,
+		artist.CreatedAt,
+		artist.UpdatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *ArtistStorage) Get(ctx context.Context, id int) (*Artist, error) {
+	const query = `SELECT ` + artistColumns + ` FROM artists WHERE id = $1`
+
+	artist, err := scanArtist(conn(ctx, s.db).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("artist")
+		}
+		return nil, err
+	}
+
+	return artist, nil
+}
+
+// GetByName returns the oldest artist whose name matches name regardless of
+// case.
+func (s *ArtistStorage) GetByName(ctx context.Context, name string) (*Artist, error) {
+	const query = `SELECT ` + artistColumns + ` FROM artists WHERE lower(name) = lower($1) ORDER BY id LIMIT 1`
+
+	artist, err := scanArtist(conn(ctx, s.db).QueryRowContext(ctx, query, name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("artist")
+		}
+		return nil, err
+	}
+
+	return artist, nil
+}
+
+// GetArtists returns a page of the artists ordered by name, optionally only
+// those whose name contains name.
+func (s *ArtistStorage) GetArtists(ctx context.Context, name string, page *models.PageRequest) (*models.Page[*Artist], error) {
+	q := listQuery{columns: artistColumns, from: `FROM artists`}
+
+	if name != "" {
+		q.filter("name ILIKE ?", "%"+escapeLike(name)+"%")
+	}
+
+	keys := keyset{{expr: "lower(name)"}, {expr: "id"}}
+	return queryPage(ctx, conn(ctx, s.db), q, keys, page, scanArtist)
+}
+
+// Update renames an artist. The tracks it is the primary artist of carry
+// its name as well, so they are renamed with it and move to a new version.
+func (s *ArtistStorage) Update(ctx context.Context, artist *Artist) error {
+	const query = `UPDATE artists SET name = $1, updated_at = $2 WHERE id = $3`
+	const tracksQuery = `
+		UPDATE tracks t SET artist = $1, version = t.version + 1
+		FROM track_artists ta
+		WHERE ta.track_id = t.id AND ta.artist_id = $2 AND ta.role = 'primary'
+		RETURNING t.id`
+
+	return withTx(ctx, s.db, func(ctx context.Context) error {
+		result, err := conn(ctx, s.db).ExecContext(ctx, query, artist.Name, artist.UpdatedAt, artist.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := requireRow(result, "artist"); err != nil {
+			return err
+		}
+
+		rows, err := conn(ctx, s.db).QueryContext(ctx, tracksQuery, artist.Name, artist.ID)
+		if err != nil {
+			return err
+		}
+
+		var trackIDs []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			trackIDs = append(trackIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range trackIDs {
+			if err := indexTrackSuggestions(ctx, s.db, id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Delete removes an artist along with its track credits. Every track needs
+// a primary artist, so an artist that is still one is kept and a Conflict is
+// returned instead.
+func (s *ArtistStorage) Delete(ctx context.Context, id int) error {
+	// Locking the artist keeps it from being credited as primary until it
+	// is gone.
+	const checkQuery = `
+		SELECT EXISTS (
+			SELECT 1 FROM track_artists ta WHERE ta.artist_id = a.id AND ta.role = 'primary'
+		)
+		FROM artists a
+		WHERE a.id = $1
+		FOR UPDATE OF a`
+	const query = `DELETE FROM artists WHERE id = $1`
+
+	return withTx(ctx, s.db, func(ctx context.Context) error {
+		var primary bool
+		if err := conn(ctx, s.db).QueryRowContext(ctx, checkQuery, id).Scan(&primary); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return domain.NotFound("artist")
+			}
+			return err
+		}
+
+		if primary {
+			return domain.New(domain.ErrConflict, "artist is the primary artist of tracks, credit another artist on them first")
+		}
+
+		result, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+
+		return requireRow(result, "artist")
+	})
+}
+
+// GetCredits returns the credited artists of each of trackIDs, keyed by
+// track ID, in the order they were credited.
+func (s *ArtistStorage) GetCredits(ctx context.Context, trackIDs []int) (map[int][]*Credit, error) {
+	credits := make(map[int][]*Credit)
+	if len(trackIDs) == 0 {
+		return credits, nil
+	}
+
+	const query = `
+		SELECT ta.track_id, ta.artist_id, a.name, ta.role
+		FROM track_artists ta
+		JOIN artists a ON a.id = ta.artist_id
+		WHERE ta.track_id = ANY($1)
+		ORDER BY ta.track_id, ta.position`
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, pq.Array(trackIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		credit := &Credit{}
+		if err := rows.Scan(&credit.TrackID, &credit.ArtistID, &credit.Name, &credit.Role); err != nil {
+			return nil, err
+		}
+		credits[credit.TrackID] = append(credits[credit.TrackID], credit)
+	}
+
+	return credits, rows.Err()
+}
+
+// SetCredits replaces the credited artists of a track. The order of credits
+// is kept.
+func (s *ArtistStorage) SetCredits(ctx context.Context, trackID int, credits []*Credit) error {
+	const deleteQuery = `DELETE FROM track_artists WHERE track_id = $1`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, deleteQuery, trackID); err != nil {
+		return fmt.Errorf("failed to delete credits: %w", err)
+	}
+
+	if len(credits) == 0 {
+		return nil
+	}
+
+	artistIDs := make([]int, len(credits))
+	roles := make([]string, len(credits))
+	for i, credit := range credits {
+		artistIDs[i] = credit.ArtistID
+		roles[i] = credit.Role
+	}
+
+	const query = `
+		INSERT INTO track_artists (track_id, artist_id, role, position)
+		SELECT $1, c.artist_id, c.role, c.ordinality - 1
+		FROM UNNEST($2::INTEGER[], $3::TEXT[]) WITH ORDINALITY AS c(artist_id, role, ordinality)`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, query, trackID, pq.Array(artistIDs), pq.Array(roles)); err != nil {
+		return fmt.Errorf("failed to add credits: %w", mapError(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestArtistStorage(t *testing.T) (*ArtistStorage, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	storage, _ := NewArtistStorage(db)
+	return storage, mock
+}
+
+func TestArtistUpdateRenamesTracks(t *testing.T) {
+	storage, mock := newTestArtistStorage(t)
+	artist := &Artist{ID: 3, Name: "New Name", UpdatedAt: time.Now().UTC()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE artists SET name = \$1`).
+		WithArgs(artist.Name, artist.UpdatedAt, artist.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`UPDATE tracks t SET artist = \$1, version = t.version \+ 1 .* ta.role = 'primary'`).
+		WithArgs(artist.Name, artist.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10).AddRow(11))
+	for _, id := range []int{10, 11} {
+		mock.ExpectExec(`DELETE FROM search_suggestions WHERE track_id = \$1`).
+			WithArgs(id).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`INSERT INTO search_suggestions`).
+			WithArgs(id).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+	}
+	mock.ExpectCommit()
+
+	if err := storage.Update(context.Background(), artist); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArtistUpdateMissing(t *testing.T) {
+	storage, mock := newTestArtistStorage(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE artists SET name = \$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if err := storage.Update(context.Background(), &Artist{ID: 3, Name: "New Name"}); err == nil {
+		t.Error("Update() of a missing artist succeeded")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetArtistsMatchesWildcardsLiterally(t *testing.T) {
+	storage, mock := newTestArtistStorage(t)
+
+	mock.ExpectQuery(`FROM artists WHERE name ILIKE \$1`).
+		WithArgs(`%100\%\_pure\\%`, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at"}))
+
+	_, err := storage.GetArtists(context.Background(), `100%_pure\`, &models.PageRequest{Limit: 20})
+	if err != nil {
+		t.Fatalf("GetArtists() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArtistDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    *sqlmock.Rows
+		wantErr error
+	}{
+		{name: "uncredited artist", rows: sqlmock.NewRows([]string{"exists"}).AddRow(false)},
+		{name: "primary artist of a track", rows: sqlmock.NewRows([]string{"exists"}).AddRow(true), wantErr: domain.ErrConflict},
+		{name: "missing artist", rows: sqlmock.NewRows([]string{"exists"}), wantErr: domain.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, mock := newTestArtistStorage(t)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT EXISTS .* ta.role = 'primary' .* FOR UPDATE OF a`).
+				WithArgs(3).
+				WillReturnRows(tt.rows)
+			if tt.wantErr == nil {
+				mock.ExpectExec(`DELETE FROM artists WHERE id = \$1`).
+					WithArgs(3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err := storage.Delete(context.Background(), 3)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Delete() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"music-hosting/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// requireRow reports a NotFound error for resource if a statement did not
+// affect any row.
+func requireRow(result sql.Result, resource string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return domain.NotFound(resource)
+	}
+
+	return nil
+}
+
+// scanVersion reads the version returned by a versioned statement. No row
+// means that the version did not match.
+func scanVersion(row *sql.Row, resource string) (int, error) {
+	var version int
+	if err := row.Scan(&version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, versionMismatch(resource)
+		}
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func versionMismatch(resource string) error {
+	return domain.New(domain.ErrPreconditionFailed, resource+" has been modified by another request")
+}
+
+// constraintFields maps constraints to the API field they protect.
+var constraintFields = map[string]string{
+	"users_login_unique_idx":        "login",
+	"users_email_unique_idx":        "email",
+	"playlist_tracks_track_id_fkey": "tracks_id",
+	"track_artists_artist_id_fkey":  "artists",
+	"track_artists_pkey":            "artists",
+	"tracks_album_id_fkey":          "album_id",
+	"albums_artist_id_fkey":         "artist_id",
+}
+
+// mapError turns unique violations into a domain conflict error and
+// references to missing rows into a validation error. Any other error is
+// returned unchanged.
+func mapError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	field, ok := constraintFields[pqErr.Constraint]
+	if !ok {
+		field = pqErr.Constraint
+	}
+
+	switch pqErr.Code {
+	case uniqueViolation:
+		return domain.Conflict(field)
+	case foreignKeyViolation:
+		return domain.Invalid(field, "refers to a missing resource")
+	}
+
+	return err
+}
@@ -11,33 +11,159 @@ type User struct {
 	Email    string
 	Password string
 	Salt     string
+	Role     string
+
+	EmailVerifiedAt *time.Time
+
+	TOTPSecret   string
+	TOTPEnabled  bool
+	TOTPLastStep int64
+	TOTPFailures int
+	TOTPFailedAt *time.Time
+}
+
+type UserToken struct {
+	UserID    int
+	Email     string
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type Session struct {
+	ID               int
+	UserID           int
+	RefreshTokenHash string
+	ExpiresAt        time.Time
+	CreatedAt        time.Time
 }
 
 type Track struct {
-	ID       int
+	ID          int
+	OwnerID     int
+	Name        string
+	Artist      string
+	URL         string
+	Likes       int
+	Dislikes    int
+	StorageKey  string
+	Size        int64
+	MimeType    string
+	Checksum    string
+	Album       string
+	TrackNumber int
+	Year        int
+	Genre       string
+	DurationMs  int
+	CoverKey    string
+	Bitrate     int
+	Codec       string
+	SampleRate  int
+	Channels    int
+	AlbumID     int
+	DiscNumber  int
+	Plays       int
+	CreatedAt   time.Time
+	Version     int
+}
+
+type Artist struct {
+	ID        int
+	Name      string
+	OwnerID   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Album struct {
+	ID          int
+	Title       string
+	ArtistID    int
+	ArtistName  string
+	ReleaseDate *time.Time
+	CoverKey    string
+	OwnerID     int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Credit links an artist to a track in a given role.
+type Credit struct {
+	TrackID  int
+	ArtistID int
 	Name     string
-	Artist   string
-	URL      string
-	Likes    int
-	Dislikes int
+	Role     string
+}
+
+type Reaction struct {
+	UserID    int
+	TrackID   int
+	Value     int
+	CreatedAt time.Time
 }
 
 type Playlist struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	UserID    int       `json:"user_id"`
-	Tracks    []*Track  `json:"tracks"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int              `json:"id"`
+	Name      string           `json:"name"`
+	UserID    int              `json:"user_id"`
+	Tracks    []*Track         `json:"tracks"`
+	Entries   []*PlaylistEntry `json:"entries"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Version   int              `json:"version"`
+}
+
+// PlaylistEntry is one occurrence of a track in a playlist. The same track
+// can appear in several entries.
+type PlaylistEntry struct {
+	ID       int
+	Position int
+	TrackID  int
 }
 
 func (t *Track) ConvertToModel() *models.Track {
 	return &models.Track{
-		ID:       t.ID,
-		Name:     t.Name,
-		Artist:   t.Artist,
-		URL:      t.URL,
-		Likes:    t.Likes,
-		Dislikes: t.Dislikes,
+		ID:          t.ID,
+		OwnerID:     t.OwnerID,
+		Name:        t.Name,
+		Artist:      t.Artist,
+		URL:         t.URL,
+		Likes:       t.Likes,
+		Dislikes:    t.Dislikes,
+		StorageKey:  t.StorageKey,
+		Size:        t.Size,
+		MimeType:    t.MimeType,
+		Checksum:    t.Checksum,
+		Album:       t.Album,
+		TrackNumber: t.TrackNumber,
+		Year:        t.Year,
+		Genre:       t.Genre,
+		DurationMs:  t.DurationMs,
+		CoverKey:    t.CoverKey,
+		Bitrate:     t.Bitrate,
+		Codec:       t.Codec,
+		SampleRate:  t.SampleRate,
+		Channels:    t.Channels,
+		AlbumID:     t.AlbumID,
+		DiscNumber:  t.DiscNumber,
+		Plays:       t.Plays,
+		CreatedAt:   t.CreatedAt,
+		Version:     t.Version,
 	}
 }
+
+// Hit is a search result with its relevance and its matched name, in which
+// the query terms are highlighted.
+type Hit[T any] struct {
+	Item      T
+	Score     float64
+	Highlight string
+}
+
+// Suggestion completes a partially typed search. ID refers to the track,
+// artist or playlist named by Label, depending on Kind.
+type Suggestion struct {
+	Kind  string
+	ID    int
+	Label string
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"hash/crc32"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortKey is an expression a list is ordered by. It must not be NULL.
+type sortKey struct {
+	expr string
+	desc bool
+}
+
+// keyset is the ordering of a paginated list. The keys together must be
+// unique so that every row has a distinct position to resume from.
+type keyset []sortKey
+
+// cursor is the position of a row in a keyset ordering. Before marks a
+// cursor to the rows preceding it rather than following it. Order
+// identifies the ordering, so that a cursor cannot be used with a listing
+// sorted differently.
+type cursor struct {
+	Values []any  `json:"v"`
+	Before bool   `json:"b,omitempty"`
+	Order  uint32 `json:"o"`
+}
+
+func encodeCursor(c cursor) string {
+	for i, v := range c.Values {
+		switch v := v.(type) {
+		case time.Time:
+			c.Values[i] = v.Format(time.RFC3339Nano)
+		case []byte:
+			c.Values[i] = string(v)
+		}
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, keys keyset) (cursor, error) {
+	invalid := domain.Invalid("cursor", "is invalid")
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, invalid
+	}
+
+	var c cursor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil || c.Order != keys.id() || len(c.Values) != len(keys) {
+		return cursor{}, invalid
+	}
+
+	for i, v := range c.Values {
+		switch v := v.(type) {
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil {
+				return cursor{}, invalid
+			}
+			c.Values[i] = n
+		case string:
+		default:
+			return cursor{}, invalid
+		}
+	}
+
+	return c, nil
+}
+
+// id identifies the ordering in cursors.
+func (k keyset) id() uint32 {
+	return crc32.ChecksumIEEE([]byte(k.orderBy(false)))
+}
+
+// columns returns the key expressions for a select list.
+func (k keyset) columns() string {
+	exprs := make([]string, len(k))
+	for i, key := range k {
+		exprs[i] = key.expr
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// orderBy returns the ORDER BY clause, reversed when paging backwards.
+func (k keyset) orderBy(backward bool) string {
+	terms := make([]string, len(k))
+	for i, key := range k {
+		terms[i] = key.expr
+		if key.desc != backward {
+			terms[i] += " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// after returns the condition selecting the rows that come after a cursor
+// in the ordering, or before it when paging backwards. The values of the
+// cursor are bound to placeholders numbered from first.
+func (k keyset) after(backward bool, first int) string {
+	var alternatives []string
+	for i, key := range k {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, k[j].expr+" = $"+strconv.Itoa(first+j))
+		}
+
+		op := " > $"
+		if key.desc != backward {
+			op = " < $"
+		}
+		terms = append(terms, key.expr+op+strconv.Itoa(first+i))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// listQuery is a paginated SELECT. The key columns are appended to columns
+// and the keyset condition to conditions when the query is run.
+type listQuery struct {
+	columns    string
+	from       string
+	conditions []string
+	args       []any
+}
+
+// filter adds condition to the query, binding each ? in it to arg.
+func (q *listQuery) filter(condition string, arg any) {
+	q.args = append(q.args, arg)
+	q.conditions = append(q.conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(q.args))))
+}
+
+// queryPage reads the page of q that page asks for. scan reads columns and
+// stores the key columns that follow them into extra.
+func queryPage[T any](
+	ctx context.Context,
+	db querier,
+	q listQuery,
+	keys keyset,
+	page *models.PageRequest,
+	scan func(row rowScanner, extra ...interface{}) (T, error),
+) (*models.Page[T], error) {
+	result := &models.Page[T]{}
+
+	if page.Total {
+		query := `SELECT COUNT(*) ` + q.from + where(q.conditions)
+		var total int
+		if err := db.QueryRowContext(ctx, query, q.args...).Scan(&total); err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
+
+	conditions := slices.Clone(q.conditions)
+	args := slices.Clone(q.args)
+	var at cursor
+	if page.Cursor != "" {
+		var err error
+		at, err = decodeCursor(page.Cursor, keys)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, keys.after(at.Before, len(args)+1))
+		args = append(args, at.Values...)
+	}
+
+	// One row more than asked for tells whether there is a further page.
+	args = append(args, page.Limit+1)
+	query := `SELECT ` + q.columns + `, ` + keys.columns() + ` ` + q.from + where(conditions) +
+		keys.orderBy(at.Before) + ` LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions [][]any
+	for rows.Next() {
+		values := make([]any, len(keys))
+		extra := make([]interface{}, len(keys))
+		for i := range values {
+			extra[i] = &values[i]
+		}
+
+		item, err := scan(rows, extra...)
+		if err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, item)
+		positions = append(positions, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	more := len(result.Items) > page.Limit
+	if more {
+		result.Items = result.Items[:page.Limit]
+		positions = positions[:page.Limit]
+	}
+	if at.Before {
+		slices.Reverse(result.Items)
+		slices.Reverse(positions)
+	}
+
+	if len(result.Items) == 0 {
+		return result, nil
+	}
+
+	// Coming back from a later page means there is a next one, and moving
+	// on from an earlier page means there is a previous one.
+	if more || at.Before {
+		result.Next = encodeCursor(cursor{Values: positions[len(positions)-1], Order: keys.id()})
+	}
+	if (more && at.Before) || (!at.Before && page.Cursor != "") {
+		result.Prev = encodeCursor(cursor{Values: positions[0], Before: true, Order: keys.id()})
+	}
+
+	return result, nil
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
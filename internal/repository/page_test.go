@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var testKeys = keyset{{expr: "lower(name)"}, {expr: "id"}}
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2025, 2, 1, 12, 30, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		name   string
+		keys   keyset
+		cursor cursor
+		want   []any
+	}{
+		{
+			name:   "name and id",
+			keys:   testKeys,
+			cursor: cursor{Values: []any{"abba", int64(42)}},
+			want:   []any{"abba", int64(42)},
+		},
+		{
+			name:   "backward",
+			keys:   testKeys,
+			cursor: cursor{Values: []any{"abba", int64(42)}, Before: true},
+			want:   []any{"abba", int64(42)},
+		},
+		{
+			name:   "bytes",
+			keys:   testKeys,
+			cursor: cursor{Values: []any{[]byte("abba"), int64(42)}},
+			want:   []any{"abba", int64(42)},
+		},
+		{
+			name:   "time",
+			keys:   keyset{{expr: "created_at", desc: true}, {expr: "id", desc: true}},
+			cursor: cursor{Values: []any{created, int64(7)}},
+			want:   []any{created.Format(time.RFC3339Nano), int64(7)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cursor.Order = tt.keys.id()
+			got, err := decodeCursor(encodeCursor(tt.cursor), tt.keys)
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Values, tt.want) {
+				t.Errorf("Values = %#v, want %#v", got.Values, tt.want)
+			}
+			if got.Before != tt.cursor.Before {
+				t.Errorf("Before = %v, want %v", got.Before, tt.cursor.Before)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	raw := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+	byID := keyset{{expr: "id"}}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "not base64", cursor: "!!!"},
+		{name: "not json", cursor: raw("abba")},
+		{name: "other ordering", cursor: encodeCursor(cursor{Values: []any{int64(1)}, Order: byID.id()})},
+		{name: "missing order", cursor: raw(`{"v":["abba",1]}`)},
+		{name: "too few values", cursor: encodeCursor(cursor{Values: []any{"abba"}, Order: testKeys.id()})},
+		{name: "too many values", cursor: encodeCursor(cursor{Values: []any{"abba", int64(1), int64(2)}, Order: testKeys.id()})},
+		{name: "fractional number", cursor: encodeCursor(cursor{Values: []any{"abba", 1.5}, Order: testKeys.id()})},
+		{name: "boolean value", cursor: encodeCursor(cursor{Values: []any{"abba", true}, Order: testKeys.id()})},
+		{name: "object value", cursor: encodeCursor(cursor{Values: []any{"abba", map[string]any{"x": 1}}, Order: testKeys.id()})},
+		{name: "null value", cursor: encodeCursor(cursor{Values: []any{"abba", nil}, Order: testKeys.id()})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor, testKeys); !errors.Is(err, domain.ErrValidation) {
+				t.Errorf("decodeCursor() error = %v, want %v", err, domain.ErrValidation)
+			}
+		})
+	}
+}
+
+func TestKeysetAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     keyset
+		backward bool
+		want     string
+	}{
+		{
+			name: "ascending",
+			keys: testKeys,
+			want: "((lower(name) > $3) OR (lower(name) = $3 AND id > $4))",
+		},
+		{
+			name:     "ascending backward",
+			keys:     testKeys,
+			backward: true,
+			want:     "((lower(name) < $3) OR (lower(name) = $3 AND id < $4))",
+		},
+		{
+			name: "descending with ascending tie-break",
+			keys: keyset{{expr: "plays", desc: true}, {expr: "id"}},
+			want: "((plays < $3) OR (plays = $3 AND id > $4))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.keys.after(tt.backward, 3); got != tt.want {
+				t.Errorf("after() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// scanTestRow reads the id selected by the queries of TestQueryPage.
+func scanTestRow(row rowScanner, extra ...interface{}) (int, error) {
+	var id int
+	err := row.Scan(append([]interface{}{&id}, extra...)...)
+	return id, err
+}
+
+func TestQueryPage(t *testing.T) {
+	columns := []string{"id", "name_key", "id_key"}
+	q := listQuery{columns: "id", from: "FROM artists"}
+
+	t.Run("first page", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		// Two artists share a name, so only the id tells them apart.
+		mock.ExpectQuery(`SELECT id, lower\(name\), id FROM artists ORDER BY lower\(name\), id LIMIT \$1`).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, "abba", 1).
+				AddRow(5, "abba", 5).
+				AddRow(2, "blur", 2))
+
+		page, err := queryPage(context.Background(), db, q, testKeys, &models.PageRequest{Limit: 2}, scanTestRow)
+		if err != nil {
+			t.Fatalf("queryPage() error = %v", err)
+		}
+		if !reflect.DeepEqual(page.Items, []int{1, 5}) {
+			t.Errorf("Items = %v, want [1 5]", page.Items)
+		}
+		if page.Prev != "" {
+			t.Errorf("Prev = %q on the first page", page.Prev)
+		}
+
+		next, err := decodeCursor(page.Next, testKeys)
+		if err != nil {
+			t.Fatalf("decode Next: %v", err)
+		}
+		if want := []any{"abba", int64(5)}; next.Before || !reflect.DeepEqual(next.Values, want) {
+			t.Errorf("Next = %+v, want after %v", next, want)
+		}
+	})
+
+	t.Run("next page", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		at := encodeCursor(cursor{Values: []any{"abba", int64(5)}, Order: testKeys.id()})
+		mock.ExpectQuery(`FROM artists WHERE \(\(lower\(name\) > \$1\) OR \(lower\(name\) = \$1 AND id > \$2\)\) ORDER BY lower\(name\), id LIMIT \$3`).
+			WithArgs("abba", int64(5), 3).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "blur", 2))
+
+		page, err := queryPage(context.Background(), db, q, testKeys, &models.PageRequest{Cursor: at, Limit: 2}, scanTestRow)
+		if err != nil {
+			t.Fatalf("queryPage() error = %v", err)
+		}
+		if !reflect.DeepEqual(page.Items, []int{2}) {
+			t.Errorf("Items = %v, want [2]", page.Items)
+		}
+		if page.Next != "" {
+			t.Errorf("Next = %q on the last page", page.Next)
+		}
+
+		prev, err := decodeCursor(page.Prev, testKeys)
+		if err != nil {
+			t.Fatalf("decode Prev: %v", err)
+		}
+		if want := []any{"blur", int64(2)}; !prev.Before || !reflect.DeepEqual(prev.Values, want) {
+			t.Errorf("Prev = %+v, want before %v", prev, want)
+		}
+	})
+
+	t.Run("previous page", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		// Paging backwards reads the rows in reverse and puts them back in
+		// order.
+		at := encodeCursor(cursor{Values: []any{"blur", int64(2)}, Before: true, Order: testKeys.id()})
+		mock.ExpectQuery(`FROM artists WHERE \(\(lower\(name\) < \$1\) OR \(lower\(name\) = \$1 AND id < \$2\)\) ORDER BY lower\(name\) DESC, id DESC LIMIT \$3`).
+			WithArgs("blur", int64(2), 2).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(5, "abba", 5).AddRow(1, "abba", 1))
+
+		page, err := queryPage(context.Background(), db, q, testKeys, &models.PageRequest{Cursor: at, Limit: 1}, scanTestRow)
+		if err != nil {
+			t.Fatalf("queryPage() error = %v", err)
+		}
+		if !reflect.DeepEqual(page.Items, []int{5}) {
+			t.Errorf("Items = %v, want [5]", page.Items)
+		}
+
+		next, err := decodeCursor(page.Next, testKeys)
+		if err != nil {
+			t.Fatalf("decode Next: %v", err)
+		}
+		if want := []any{"abba", int64(5)}; next.Before || !reflect.DeepEqual(next.Values, want) {
+			t.Errorf("Next = %+v, want after %v", next, want)
+		}
+
+		prev, err := decodeCursor(page.Prev, testKeys)
+		if err != nil {
+			t.Fatalf("decode Prev: %v", err)
+		}
+		if want := []any{"abba", int64(5)}; !prev.Before || !reflect.DeepEqual(prev.Values, want) {
+			t.Errorf("Prev = %+v, want before %v", prev, want)
+		}
+	})
+
+	t.Run("tampered cursor", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		at := encodeCursor(cursor{Values: []any{"abba", int64(5)}, Order: testKeys.id() + 1})
+		_, err = queryPage(context.Background(), db, q, testKeys, &models.PageRequest{Cursor: at, Limit: 2}, scanTestRow)
+		if !errors.Is(err, domain.ErrValidation) {
+			t.Errorf("queryPage() error = %v, want %v", err, domain.ErrValidation)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
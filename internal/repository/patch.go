@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Changes maps column names to their new values for a partial update. A nil
+// value sets the column to NULL.
+type Changes map[string]any
+
+// Has reports whether any of the columns is changed.
+func (c Changes) Has(columns ...string) bool {
+	for _, column := range columns {
+		if _, ok := c[column]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// setClauses turns changes into "column = $n" assignments, numbering the
+// placeholders from 1 in the order of columns. Only the listed columns may
+// be changed.
+func setClauses(changes Changes, columns ...string) ([]string, []any, error) {
+	clauses := make([]string, 0, len(changes))
+	args := make([]any, 0, len(changes))
+
+	for _, column := range columns {
+		value, ok := changes[column]
+		if !ok {
+			continue
+		}
+
+		args = append(args, value)
+		clauses = append(clauses, column+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if len(clauses) != len(changes) {
+		for column := range changes {
+			if !slices.Contains(columns, column) {
+				return nil, nil, fmt.Errorf("column %q cannot be updated", column)
+			}
+		}
+	}
+
+	return clauses, args, nil
+}
+
+// buildVersionedUpdate is like buildUpdate but only matches the row at the
+// given version, increments it and returns the new version.
+func buildVersionedUpdate(table string, id, version int, clauses []string, args []any) (string, []any) {
+	clauses = append(clauses, "version = version + 1")
+	args = append(args, id, version)
+	query := "UPDATE " + table + " SET " + strings.Join(clauses, ", ") +
+		" WHERE id = $" + strconv.Itoa(len(args)-1) + " AND version = $" + strconv.Itoa(len(args)) +
+		" RETURNING version"
+	return query, args
+}
+
+// buildUpdate returns an UPDATE statement for the row of table with the
+// given id, along with its arguments.
+func buildUpdate(table string, id int, clauses []string, args []any) (string, []any) {
+	args = append(args, id)
+	query := "UPDATE " + table + " SET " + strings.Join(clauses, ", ") + " WHERE id = $" + strconv.Itoa(len(args))
+	return query, args
+}
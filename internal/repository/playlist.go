@@ -5,7 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
 
 	"github.com/lib/pq"
 )
@@ -19,218 +20,346 @@ func NewPlaylistStorage(db *sql.DB) (*PlaylistStorage, error) {
 }
 
 func (s *PlaylistStorage) Create(ctx context.Context, playlist *Playlist) error {
-	const query = `INSERT INTO playlists (name, user_id, created_at, updated_at) VALUES ($1, $2, $3, $4)`
-
-	_, err := s.db.ExecContext(
-		ctx,
-		query,
-		playlist.Name,
-		playlist.UserID,
-		playlist.CreatedAt,
-		playlist.UpdatedAt,
-	)
-	if err != nil {
-		return err
-	}
+	const query = `INSERT INTO playlists (name, user_id, created_at, updated_at) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	return withTx(ctx, s.db, func(ctx context.Context) error {
+		err := conn(ctx, s.db).QueryRowContext(
+			ctx,
+			query,
+			playlist.Name,
+			playlist.UserID,
+			playlist.CreatedAt,
+			playlist.UpdatedAt,
+		).Scan(&playlist.ID)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		return indexPlaylistSuggestion(ctx, s.db, playlist.ID)
+	})
 }
 
-func (s *PlaylistStorage) Get(ctx context.Context, id int) (*Playlist, error) {
-	const queryPlaylist = `SELECT id, name, user_id, created_at, updated_at FROM playlists WHERE id = $1`
+const playlistColumns = `id, name, user_id, created_at, updated_at, version`
 
+// scanPlaylist reads the columns in playlistColumns. Columns selected after
+// them are scanned into extra.
+func scanPlaylist(row rowScanner, extra ...interface{}) (*Playlist, error) {
 	playlist := &Playlist{}
-	err := s.db.QueryRowContext(ctx, queryPlaylist, id).Scan(
+	dest := []interface{}{
 		&playlist.ID,
 		&playlist.Name,
 		&playlist.UserID,
 		&playlist.CreatedAt,
 		&playlist.UpdatedAt,
-	)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
-		}
+		&playlist.Version,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
 		return nil, err
 	}
 
-	const queryTracks = `
-		SELECT t.id, t.name, t.artist, t.url, t.likes, t.dislikes
-		FROM tracks t
-		JOIN playlist_tracks pt ON pt.track_id = t.id
-		WHERE pt.playlist_id = $1
-	`
+	return playlist, nil
+}
+
+func (s *PlaylistStorage) Get(ctx context.Context, id int) (*Playlist, error) {
+	const query = `SELECT ` + playlistColumns + ` FROM playlists WHERE id = $1`
 
-	trackRows, err := s.db.QueryContext(ctx, queryTracks, id)
+	playlist, err := scanPlaylist(conn(ctx, s.db).QueryRowContext(ctx, query, id))
 	if err != nil {
-		return nil, err
-	}
-	defer trackRows.Close()
-
-	playlist.Tracks = []*Track{}
-
-	for trackRows.Next() {
-		track := &Track{}
-		if err := trackRows.Scan(
-			&track.ID,
-			&track.Name,
-			&track.Artist,
-			&track.URL,
-			&track.Likes,
-			&track.Dislikes,
-		); err != nil {
-			return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("playlist")
 		}
-		playlist.Tracks = append(playlist.Tracks, track)
+		return nil, err
 	}
 
-	if err := trackRows.Err(); err != nil {
+	if err := s.loadEntries(ctx, playlist); err != nil {
 		return nil, err
 	}
 
 	return playlist, nil
 }
 
-func (s *PlaylistStorage) GetPlaylists(ctx context.Context, name string, userID int) ([]*Playlist, error) {
-	baseQuery := `SELECT id, name, user_id, created_at, updated_at FROM playlists WHERE 1=1`
-	var args []interface{}
+// GetPlaylists returns a page of the playlists, oldest first, optionally
+// only those called name or belonging to userID.
+func (s *PlaylistStorage) GetPlaylists(ctx context.Context, name string, userID int, page *models.PageRequest) (*models.Page[*Playlist], error) {
+	q := listQuery{columns: playlistColumns, from: `FROM playlists`}
 
 	if name != "" {
-		baseQuery += " AND name = $1"
-		args = append(args, name)
+		q.filter("name = ?", name)
 	}
 	if userID != 0 {
-		baseQuery += " AND user_id = $2"
-		args = append(args, userID)
+		q.filter("user_id = ?", userID)
 	}
 
-	rows, err := s.db.QueryContext(ctx, baseQuery, args...)
+	result, err := queryPage(ctx, conn(ctx, s.db), q, keyset{{expr: "id"}}, page, scanPlaylist)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var playlists []*Playlist
-	for rows.Next() {
-		playlist := &Playlist{}
-		if err := rows.Scan(
-			&playlist.ID,
-			&playlist.Name,
-			&playlist.UserID,
-			&playlist.CreatedAt,
-			&playlist.UpdatedAt,
-		); err != nil {
-			return nil, err
-		}
+	if err := s.loadEntries(ctx, result.Items...); err != nil {
+		return nil, err
+	}
 
-		const queryTracks = `
-			SELECT t.id, t.name, t.artist, t.url, t.likes, t.dislikes
-			FROM tracks t
-			JOIN playlist_tracks pt ON pt.track_id = t.id
-			WHERE pt.playlist_id = $1
-		`
-		trackRows, err := s.db.QueryContext(ctx, queryTracks, playlist.ID)
+	return result, nil
+}
+
+// Update renames a playlist if it is still at playlist.Version and stores
+// the new version in playlist.
+func (s *PlaylistStorage) Update(ctx context.Context, playlist *Playlist) error {
+	const query = `
+		UPDATE playlists SET name = $1, updated_at = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	return withTx(ctx, s.db, func(ctx context.Context) error {
+		row := conn(ctx, s.db).QueryRowContext(ctx, query, playlist.Name, playlist.UpdatedAt, playlist.ID, playlist.Version)
+		version, err := scanVersion(row, "playlist")
 		if err != nil {
-			return nil, err
-		}
-		defer trackRows.Close()
-
-		var tracks []*Track
-		for trackRows.Next() {
-			track := &Track{}
-			if err := trackRows.Scan(
-				&track.ID,
-				&track.Name,
-				&track.Artist,
-				&track.URL,
-				&track.Likes,
-				&track.Dislikes,
-			); err != nil {
-				return nil, err
-			}
-			tracks = append(tracks, track)
+			return err
 		}
 
-		playlist.Tracks = tracks
-		playlists = append(playlists, playlist)
+		playlist.Version = version
+		return indexPlaylistSuggestion(ctx, s.db, playlist.ID)
+	})
+}
+
+var playlistPatchColumns = []string{"name", "updated_at"}
+
+// Patch updates only the columns in changes if the playlist is still at
+// version, and returns the new version.
+func (s *PlaylistStorage) Patch(ctx context.Context, id, version int, changes Changes) (int, error) {
+	if len(changes) == 0 {
+		return version, nil
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	clauses, args, err := setClauses(changes, playlistPatchColumns...)
+	if err != nil {
+		return 0, err
 	}
 
-	return playlists, nil
+	query, args := buildVersionedUpdate("playlists", id, version, clauses, args)
+	err = withTx(ctx, s.db, func(ctx context.Context) error {
+		version, err = scanVersion(conn(ctx, s.db).QueryRowContext(ctx, query, args...), "playlist")
+		if err != nil {
+			return err
+		}
+
+		if !changes.Has("name") {
+			return nil
+		}
+		return indexPlaylistSuggestion(ctx, s.db, id)
+	})
+	return version, err
 }
 
-func (s *PlaylistStorage) Update(ctx context.Context, playlist *Playlist) error {
-	const query = `UPDATE playlists SET name = $1, user_id = $2, updated_at = $3 WHERE id = $4`
+// Delete removes a playlist if it is still at version.
+func (s *PlaylistStorage) Delete(ctx context.Context, id, version int) error {
+	const query = `DELETE FROM playlists WHERE id = $1 AND version = $2`
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, id, version)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.ExecContext(ctx, query, playlist.Name, playlist.UserID, playlist.UpdatedAt, playlist.ID)
+	n, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if n == 0 {
+		return versionMismatch("playlist")
+	}
+
 	return nil
 }
 
-func (s *PlaylistStorage) Delete(ctx context.Context, id int) error {
-	const query = `DELETE FROM playlists WHERE id = $1`
-	_, err := s.db.ExecContext(ctx, query, id)
+// loadEntries fills in the tracks of playlists in order, along with the
+// entries they belong to, in a single query.
+func (s *PlaylistStorage) loadEntries(ctx context.Context, playlists ...*Playlist) error {
+	const query = `
+		SELECT ` + trackColumns + `, pt.id, pt.position, pt.playlist_id
+		FROM tracks t
+		JOIN playlist_tracks pt ON pt.track_id = t.id
+		WHERE pt.playlist_id = ANY($1)
+		ORDER BY pt.playlist_id, pt.position`
+
+	if len(playlists) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Playlist, len(playlists))
+	ids := make([]int, 0, len(playlists))
+	for _, playlist := range playlists {
+		playlist.Tracks = []*Track{}
+		playlist.Entries = []*PlaylistEntry{}
+		byID[playlist.ID] = playlist
+		ids = append(ids, playlist.ID)
+	}
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, pq.Array(ids))
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	return nil
+	for rows.Next() {
+		entry := &PlaylistEntry{}
+		var playlistID int
+		track, err := scanTrack(rows, &entry.ID, &entry.Position, &playlistID)
+		if err != nil {
+			return err
+		}
+
+		entry.TrackID = track.ID
+		playlist := byID[playlistID]
+		playlist.Tracks = append(playlist.Tracks, track)
+		playlist.Entries = append(playlist.Entries, entry)
+	}
+
+	return rows.Err()
 }
 
-func (s *PlaylistStorage) DeleteTracks(ctx context.Context, playlistID int, trackIDs []int) error {
-	const query = `DELETE FROM playlist_tracks WHERE playlist_id = $1 AND track_id = $2`
+// GetEntryIDs returns the IDs of the entries of a playlist in order.
+func (s *PlaylistStorage) GetEntryIDs(ctx context.Context, playlistID int) ([]int, error) {
+	const query = `SELECT id FROM playlist_tracks WHERE playlist_id = $1 ORDER BY position`
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query playlist entries: %w", err)
+	}
+	defer rows.Close()
 
-	if _, err := s.db.ExecContext(ctx, query, playlistID, pq.Array(trackIDs)); err != nil {
+	var entryIDs []int
+	for rows.Next() {
+		var entryID int
+		if err := rows.Scan(&entryID); err != nil {
+			return nil, fmt.Errorf("failed to scan entry ID: %w", err)
+		}
+		entryIDs = append(entryIDs, entryID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return entryIDs, nil
+}
+
+// ReplaceTracks makes trackIDs, in order, the only entries of a playlist.
+func (s *PlaylistStorage) ReplaceTracks(ctx context.Context, playlistID int, trackIDs []int) error {
+	const query = `DELETE FROM playlist_tracks WHERE playlist_id = $1`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, query, playlistID); err != nil {
 		return fmt.Errorf("failed to delete tracks: %w", err)
 	}
 
-	return nil
+	return s.InsertTracks(ctx, playlistID, 0, trackIDs)
 }
 
-func (s *PlaylistStorage) AddTracks(ctx context.Context, playlistID int, trackIDs []int) error {
-	const insertQuery = `INSERT INTO playlist_tracks (playlist_id, track_id) VALUES ($1, $2)`
+// InsertTracks adds an entry for each of trackIDs before the entry at index,
+// or at the end if there is none. Entries from there on are moved back to
+// make room.
+func (s *PlaylistStorage) InsertTracks(ctx context.Context, playlistID, index int, trackIDs []int) error {
+	if len(trackIDs) == 0 {
+		return nil
+	}
 
-	values := []string{}
-	args := []interface{}{}
-	for i, trackID := range trackIDs {
-		values = append(values, fmt.Sprintf("($1, $%d)", i+2))
-		args = append(args, trackID)
+	// Positions are only expected to be contiguous, so the index is looked
+	// up rather than taken for a position.
+	const positionQuery = `
+		SELECT COALESCE(
+			(SELECT position FROM playlist_tracks WHERE playlist_id = $1 ORDER BY position OFFSET $2 LIMIT 1),
+			(SELECT MAX(position) + 1 FROM playlist_tracks WHERE playlist_id = $1),
+			0
+		)`
+
+	var position int
+	if err := conn(ctx, s.db).QueryRowContext(ctx, positionQuery, playlistID, index).Scan(&position); err != nil {
+		return fmt.Errorf("failed to find insert position: %w", err)
 	}
-	query := fmt.Sprintf(insertQuery, strings.Join(values, ", "))
 
-	if _, err := s.db.ExecContext(ctx, query, append([]interface{}{playlistID}, args...)...); err != nil {
-		return fmt.Errorf("failed to add tracks: %w", err)
+	const shift = `
+		UPDATE playlist_tracks SET position = position + $3
+		WHERE playlist_id = $1 AND position >= $2`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, shift, playlistID, position, len(trackIDs)); err != nil {
+		return fmt.Errorf("failed to shift tracks: %w", err)
+	}
+
+	const query = `
+		INSERT INTO playlist_tracks (playlist_id, track_id, position)
+		SELECT $1, t.track_id, $2 + t.ordinality - 1
+		FROM UNNEST($3::INTEGER[]) WITH ORDINALITY AS t(track_id, ordinality)`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, query, playlistID, position, pq.Array(trackIDs)); err != nil {
+		return fmt.Errorf("failed to add tracks: %w", mapError(err))
 	}
 
 	return nil
 }
 
-func (s *PlaylistStorage) GetExistingTracks(ctx context.Context, playlistID int) ([]int, error) {
-	const query = `SELECT track_id FROM playlist_tracks WHERE playlist_id = $1`
-	rows, err := s.db.QueryContext(ctx, query, playlistID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query existing tracks: %w", err)
+// SetEntryOrder moves each of entryIDs to its index in the slice.
+func (s *PlaylistStorage) SetEntryOrder(ctx context.Context, playlistID int, entryIDs []int) error {
+	const query = `
+		UPDATE playlist_tracks pt SET position = e.ordinality - 1
+		FROM UNNEST($2::INTEGER[]) WITH ORDINALITY AS e(id, ordinality)
+		WHERE pt.id = e.id AND pt.playlist_id = $1 AND pt.position <> e.ordinality - 1`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, query, playlistID, pq.Array(entryIDs)); err != nil {
+		return fmt.Errorf("failed to reorder tracks: %w", err)
 	}
-	defer rows.Close()
 
-	var trackIDs []int
-	for rows.Next() {
-		var trackID int
-		if err := rows.Scan(&trackID); err != nil {
-			return nil, fmt.Errorf("failed to scan track ID: %w", err)
+	return nil
+}
+
+// renumberEntries closes the gaps left in the positions of the entries of
+// playlistIDs by entries removed along with their track, and moves the
+// playlists to a new version since their entries changed.
+func renumberEntries(ctx context.Context, db *sql.DB, playlistIDs []int) error {
+	const query = `
+		UPDATE playlist_tracks pt SET position = ordered.position
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY playlist_id ORDER BY position) - 1 AS position
+			FROM playlist_tracks
+			WHERE playlist_id = ANY($1)
+		) ordered
+		WHERE pt.id = ordered.id AND pt.position <> ordered.position`
+	const versionQuery = `
+		UPDATE playlists SET updated_at = NOW(), version = version + 1
+		WHERE id = ANY($1)`
+
+	if _, err := conn(ctx, db).ExecContext(ctx, query, pq.Array(playlistIDs)); err != nil {
+		return fmt.Errorf("failed to renumber playlist entries: %w", err)
+	}
+
+	if _, err := conn(ctx, db).ExecContext(ctx, versionQuery, pq.Array(playlistIDs)); err != nil {
+		return fmt.Errorf("failed to update playlists: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveEntry deletes an entry from a playlist and moves the entries after
+// it up by one.
+func (s *PlaylistStorage) RemoveEntry(ctx context.Context, playlistID, entryID int) error {
+	const query = `
+		DELETE FROM playlist_tracks WHERE id = $1 AND playlist_id = $2
+		RETURNING position`
+
+	var position int
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, entryID, playlistID).Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.NotFound("playlist entry")
 		}
-		trackIDs = append(trackIDs, trackID)
+		return err
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %w", err)
+	const shift = `
+		UPDATE playlist_tracks SET position = position - 1
+		WHERE playlist_id = $1 AND position > $2`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, shift, playlistID, position); err != nil {
+		return fmt.Errorf("failed to shift tracks: %w", err)
 	}
 
-	return trackIDs, nil
+	return nil
 }
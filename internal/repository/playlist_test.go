@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func newTestPlaylistStorage(t *testing.T) (*PlaylistStorage, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	storage, _ := NewPlaylistStorage(db)
+	return storage, mock
+}
+
+// TestInsertTracksIntoGappedPlaylist inserts into a playlist whose entries
+// are at positions 0 and 2, as left behind by a deleted track.
+func TestInsertTracksIntoGappedPlaylist(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+		// stored is the position of the entry at index, if there is one.
+		stored       any
+		wantPosition int
+	}{
+		{name: "before the first entry", index: 0, stored: 0, wantPosition: 0},
+		{name: "before the entry after the gap", index: 1, stored: 2, wantPosition: 2},
+		{name: "append", index: 2, stored: 3, wantPosition: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, mock := newTestPlaylistStorage(t)
+			trackIDs := []int{7, 8}
+
+			mock.ExpectQuery(`SELECT COALESCE\(.* OFFSET \$2 LIMIT 1\),.*MAX\(position\) \+ 1`).
+				WithArgs(4, tt.index).
+				WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(tt.stored))
+			mock.ExpectExec(`UPDATE playlist_tracks SET position = position \+ \$3`).
+				WithArgs(4, tt.wantPosition, len(trackIDs)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`INSERT INTO playlist_tracks`).
+				WithArgs(4, tt.wantPosition, pq.Array(trackIDs)).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+
+			if err := storage.InsertTracks(context.Background(), 4, tt.index, trackIDs); err != nil {
+				t.Fatalf("InsertTracks() error = %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"music-hosting/internal/models"
+)
+
+type ReactionStorage struct {
+	db *sql.DB
+}
+
+func NewReactionStorage(db *sql.DB) (*ReactionStorage, error) {
+	return &ReactionStorage{db: db}, nil
+}
+
+func (s *ReactionStorage) Set(ctx context.Context, reaction *Reaction) error {
+	const query = `
+		INSERT INTO track_reactions (user_id, track_id, value, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, track_id) DO UPDATE SET value = EXCLUDED.value, created_at = EXCLUDED.created_at`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, reaction.UserID, reaction.TrackID, reaction.Value)
+	if err != nil {
+		return err
+	}
+
+	return s.refreshCounts(ctx, reaction.TrackID)
+}
+
+func (s *ReactionStorage) Get(ctx context.Context, userID, trackID int) (*Reaction, error) {
+	const query = `SELECT user_id, track_id, value, created_at FROM track_reactions WHERE user_id = $1 AND track_id = $2`
+
+	reaction := &Reaction{}
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, userID, trackID).Scan(
+		&reaction.UserID,
+		&reaction.TrackID,
+		&reaction.Value,
+		&reaction.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return reaction, nil
+}
+
+func (s *ReactionStorage) Delete(ctx context.Context, userID, trackID int) error {
+	const query = `DELETE FROM track_reactions WHERE user_id = $1 AND track_id = $2`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID, trackID)
+	if err != nil {
+		return err
+	}
+
+	return s.refreshCounts(ctx, trackID)
+}
+
+// GetLikedTracks returns a page of the tracks userID likes, most recently
+// liked first.
+func (s *ReactionStorage) GetLikedTracks(ctx context.Context, userID int, page *models.PageRequest) (*models.Page[*Track], error) {
+	q := listQuery{
+		columns:    trackColumns,
+		from:       `FROM tracks t JOIN track_reactions r ON r.track_id = t.id`,
+		conditions: []string{"r.user_id = $1", "r.value = 1"},
+		args:       []any{userID},
+	}
+	keys := keyset{{expr: "r.created_at", desc: true}, {expr: "t.id", desc: true}}
+
+	return queryPage(ctx, conn(ctx, s.db), q, keys, page, scanTrack)
+}
+
+// refreshCounts recomputes the cached like/dislike counters of a track
+// from its reactions.
+func (s *ReactionStorage) refreshCounts(ctx context.Context, trackID int) error {
+	const query = `
+		UPDATE tracks SET
+			likes = (SELECT COUNT(*) FROM track_reactions WHERE track_id = $1 AND value = 1),
+			dislikes = (SELECT COUNT(*) FROM track_reactions WHERE track_id = $1 AND value = -1)
+		WHERE id = $1`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, trackID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
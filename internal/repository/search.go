@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+)
+
+type SearchStorage struct {
+	db *sql.DB
+}
+
+func NewSearchStorage(db *sql.DB) (*SearchStorage, error) {
+	return &SearchStorage{db: db}, nil
+}
+
+// searchQuery parses the query text in $1 once for the whole statement.
+// Full-text matching uses the accent folding "music" configuration, fuzzy
+// matching compares trigrams of the folded, lower-cased text.
+const searchQuery = `
+	WITH q AS (
+		SELECT websearch_to_tsquery('music', $1) AS query, immutable_unaccent(lower($1)) AS term
+	)`
+
+// fuzzyMatch and fuzzyScore compare the query with a column using word
+// similarity, which tolerates typos and words that are still being typed.
+func fuzzyMatch(column string) string {
+	return `q.term <% immutable_unaccent(lower(` + column + `))`
+}
+
+func fuzzyScore(column string) string {
+	return `word_similarity(q.term, immutable_unaccent(lower(` + column + `)))`
+}
+
+// Matches are delimited with private use characters rather than markup, so
+// that the text can be escaped before the delimiters become <mark> tags.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// headline returns the column with its matched terms delimited. The result
+// has to be passed through markHighlight before it is handed out.
+func headline(column string) string {
+	return `ts_headline('music', ` + column + `, q.query, 'StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", HighlightAll=TRUE')`
+}
+
+var highlightReplacer = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// markHighlight escapes a headline as HTML and wraps its matched terms in
+// <mark> tags.
+func markHighlight(headline string) string {
+	return highlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// SearchTracks finds tracks whose name, artist or album matches text, best
+// matches first.
+func (s *SearchStorage) SearchTracks(ctx context.Context, text string, limit int) ([]*Hit[*Track], error) {
+	query := searchQuery + `
+		SELECT ` + trackColumns + `,
+			ts_rank(t.search_vector, q.query) + GREATEST(` + fuzzyScore("t.name") + `, ` + fuzzyScore("t.artist") + `) AS score,
+			` + headline("t.name") + `
+		FROM tracks t, q
+		WHERE t.search_vector @@ q.query OR ` + fuzzyMatch("t.name") + ` OR ` + fuzzyMatch("t.artist") + `
+		ORDER BY score DESC, t.id
+		LIMIT $2`
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []*Hit[*Track]
+	for rows.Next() {
+		hit := &Hit[*Track]{}
+		hit.Item, err = scanTrack(rows, &hit.Score, &hit.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		hit.Highlight = markHighlight(hit.Highlight)
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+func (s *SearchStorage) SearchArtists(ctx context.Context, text string, limit int) ([]*Hit[*Artist], error) {
+	query := searchQuery + `
+		SELECT ` + artistColumns + `,
+			ts_rank(search_vector, q.query) + ` + fuzzyScore("name") + ` AS score,
+			` + headline("name") + `
+		FROM artists, q
+		WHERE search_vector @@ q.query OR ` + fuzzyMatch("name") + `
+		ORDER BY score DESC, id
+		LIMIT $2`
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []*Hit[*Artist]
+	for rows.Next() {
+		hit := &Hit[*Artist]{}
+		hit.Item, err = scanArtist(rows, &hit.Score, &hit.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		hit.Highlight = markHighlight(hit.Highlight)
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+func (s *SearchStorage) SearchAlbums(ctx context.Context, text string, limit int) ([]*Hit[*Album], error) {
+	query := searchQuery + `
+		SELECT ` + albumColumns + `,
+			ts_rank(al.search_vector, q.query) + ` + fuzzyScore("al.title") + ` AS score,
+			` + headline("al.title") + albumFrom + `, q
+		WHERE al.search_vector @@ q.query OR ` + fuzzyMatch("al.title") + `
+		ORDER BY score DESC, al.id
+		LIMIT $2`
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []*Hit[*Album]
+	for rows.Next() {
+		hit := &Hit[*Album]{}
+		hit.Item, err = scanAlbum(rows, &hit.Score, &hit.Highlight)
+		if err != nil {
+			return nil, err
+		}
+		hit.Highlight = markHighlight(hit.Highlight)
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
+
+// SearchPlaylists finds playlists by name. Their tracks are not loaded.
+func (s *SearchStorage) SearchPlaylists(ctx context.Context, text string, limit int) ([]*Hit[*Playlist], error) {
+	query := searchQuery + `
+		SELECT id, name, user_id, created_at, updated_at, version,
+			ts_rank(search_vector, q.query) + ` + fuzzyScore("name") + ` AS score,
+			` + headline("name") + `
+		FROM playlists, q
+		WHERE search_vector @@ q.query OR ` + fuzzyMatch("name") + `
+		ORDER BY score DESC, id
+		LIMIT $2`
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hits []*Hit[*Playlist]
+	for rows.Next() {
+		playlist := &Playlist{}
+		hit := &Hit[*Playlist]{Item: playlist}
+		if err := rows.Scan(
+			&playlist.ID,
+			&playlist.Name,
+			&playlist.UserID,
+			&playlist.CreatedAt,
+			&playlist.UpdatedAt,
+			&playlist.Version,
+			&hit.Score,
+			&hit.Highlight,
+		); err != nil {
+			return nil, err
+		}
+		hit.Highlight = markHighlight(hit.Highlight)
+		hits = append(hits, hit)
+	}
+
+	return hits, rows.Err()
+}
@@ -0,0 +1,29 @@
+package repository
+
+import "testing"
+
+func TestMarkHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     string
+	}{
+		{name: "plain", headline: "Blue Monday", want: "Blue Monday"},
+		{name: "match", headline: highlightStart + "Blue" + highlightStop + " Monday", want: "<mark>Blue</mark> Monday"},
+		{
+			name:     "markup in the name",
+			headline: `<img src=x onerror="alert(1)"> ` + highlightStart + "Mix" + highlightStop,
+			want:     `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>Mix</mark>`,
+		},
+		{name: "literal mark tags", headline: "<mark>x</mark>", want: "&lt;mark&gt;x&lt;/mark&gt;"},
+		{name: "ampersand", headline: "Simon & " + highlightStart + "Garfunkel" + highlightStop, want: "Simon &amp; <mark>Garfunkel</mark>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markHighlight(tt.headline); got != tt.want {
+				t.Errorf("markHighlight(%q) = %q, want %q", tt.headline, got, tt.want)
+			}
+		})
+	}
+}
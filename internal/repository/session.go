@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SessionStorage struct {
+	db *sql.DB
+}
+
+func NewSessionStorage(db *sql.DB) (*SessionStorage, error) {
+	return &SessionStorage{db: db}, nil
+}
+
+func (s *SessionStorage) Create(ctx context.Context, session *Session) (int, error) {
+	const query = `
+		INSERT INTO sessions (user_id, refresh_token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`
+
+	var id int
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, session.UserID, session.RefreshTokenHash, session.ExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetActiveByRefreshHash returns the unrevoked, unexpired session that owns
+// the given refresh token hash, or nil if there is none.
+func (s *SessionStorage) GetActiveByRefreshHash(ctx context.Context, hash string) (*Session, error) {
+	const query = `
+		SELECT id, user_id, refresh_token_hash, expires_at, created_at
+		FROM sessions
+		WHERE refresh_token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()`
+
+	session := &Session{}
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, hash).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshTokenHash,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Rotate replaces the refresh token of an active session and retires the
+// old one. It reports false if oldHash is no longer current, for example
+// because a concurrent refresh already rotated it.
+func (s *SessionStorage) Rotate(ctx context.Context, id int, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	const query = `
+		WITH rotated AS (
+			UPDATE sessions SET refresh_token_hash = $1, expires_at = $2
+			WHERE id = $3 AND refresh_token_hash = $4 AND revoked_at IS NULL
+			RETURNING id
+		)
+		INSERT INTO retired_refresh_tokens (token_hash, session_id)
+		SELECT $4, id FROM rotated`
+
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, newHash, expiresAt, id, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// RevokeByRetiredRefreshHash revokes the session a refresh token was
+// rotated out of. It reports whether an active session was revoked.
+func (s *SessionStorage) RevokeByRetiredRefreshHash(ctx context.Context, hash string) (bool, error) {
+	const query = `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = (SELECT session_id FROM retired_refresh_tokens WHERE token_hash = $1)
+			AND revoked_at IS NULL`
+
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, hash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *SessionStorage) IsActive(ctx context.Context, id int) (bool, error) {
+	const query = `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		)`
+
+	var active bool
+	if err := conn(ctx, s.db).QueryRowContext(ctx, query, id).Scan(&active); err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
+
+func (s *SessionStorage) Revoke(ctx context.Context, id int) error {
+	const query = `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeOthersForUser revokes every session of the user except keepID.
+func (s *SessionStorage) RevokeOthersForUser(ctx context.Context, userID, keepID int) error {
+	const query = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID, keepID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *SessionStorage) RevokeAllForUser(ctx context.Context, userID int) error {
+	const query = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// indexTrackSuggestions replaces the suggestions of a track with its current
+// name and artist. It must run in the transaction that changed the track.
+func indexTrackSuggestions(ctx context.Context, db *sql.DB, trackID int) error {
+	const deleteQuery = `DELETE FROM search_suggestions WHERE track_id = $1`
+	const insertQuery = `
+		INSERT INTO search_suggestions (kind, track_id, label, term)
+		SELECT k.kind, t.id, k.label, immutable_unaccent(lower(k.label))
+		FROM tracks t, LATERAL (VALUES ('track', btrim(t.name)), ('artist', btrim(t.artist))) AS k(kind, label)
+		WHERE t.id = $1 AND k.label <> ''`
+
+	if _, err := conn(ctx, db).ExecContext(ctx, deleteQuery, trackID); err != nil {
+		return err
+	}
+
+	_, err := conn(ctx, db).ExecContext(ctx, insertQuery, trackID)
+	return err
+}
+
+// indexPlaylistSuggestion replaces the suggestion of a playlist with its
+// current name. It must run in the transaction that changed the playlist.
+func indexPlaylistSuggestion(ctx context.Context, db *sql.DB, playlistID int) error {
+	const deleteQuery = `DELETE FROM search_suggestions WHERE playlist_id = $1`
+	const insertQuery = `
+		INSERT INTO search_suggestions (kind, playlist_id, label, term)
+		SELECT 'playlist', p.id, btrim(p.name), immutable_unaccent(lower(btrim(p.name)))
+		FROM playlists p
+		WHERE p.id = $1 AND btrim(p.name) <> ''`
+
+	if _, err := conn(ctx, db).ExecContext(ctx, deleteQuery, playlistID); err != nil {
+		return err
+	}
+
+	_, err := conn(ctx, db).ExecContext(ctx, insertQuery, playlistID)
+	return err
+}
+
+// Suggest returns up to limit track names, artists and playlist names that
+// start with prefix, ignoring case and accents. Shorter completions come
+// first. Artists are listed once however many tracks they have, with the
+// ID of the matching artist, if any.
+func (s *SearchStorage) Suggest(ctx context.Context, prefix string, limit int) ([]*Suggestion, error) {
+	const query = `
+		WITH p AS (SELECT immutable_unaccent(lower($1)) || '%' AS pattern)
+		(
+			SELECT 'track', s.track_id, s.label
+			FROM search_suggestions s, p
+			WHERE s.kind = 'track' AND s.term LIKE p.pattern
+			ORDER BY length(s.term), s.term, s.track_id
+			LIMIT $2
+		)
+		UNION ALL
+		(
+			SELECT 'artist', COALESCE((SELECT MIN(a.id) FROM artists a WHERE lower(a.name) = lower(x.label)), 0), x.label
+			FROM (
+				SELECT DISTINCT ON (s.term) s.term, s.label
+				FROM search_suggestions s, p
+				WHERE s.kind = 'artist' AND s.term LIKE p.pattern
+				ORDER BY s.term, s.track_id
+			) x
+			ORDER BY length(x.term), x.term
+			LIMIT $2
+		)
+		UNION ALL
+		(
+			SELECT 'playlist', s.playlist_id, s.label
+			FROM search_suggestions s, p
+			WHERE s.kind = 'playlist' AND s.term LIKE p.pattern
+			ORDER BY length(s.term), s.term, s.playlist_id
+			LIMIT $2
+		)`
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, escapeLike(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []*Suggestion
+	for rows.Next() {
+		suggestion := &Suggestion{}
+		if err := rows.Scan(&suggestion.Kind, &suggestion.ID, &suggestion.Label); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	return suggestions, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes the LIKE wildcards in s match literally.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -4,10 +4,63 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strconv"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
 	"strings"
 )
 
+const trackColumns = `t.id, COALESCE(t.owner_id, 0), t.name, t.artist, t.url, t.likes, t.dislikes,
+	COALESCE(t.storage_key, ''), COALESCE(t.size, 0), COALESCE(t.mime_type, ''), COALESCE(t.checksum, ''),
+	COALESCE(t.album, ''), COALESCE(t.track_number, 0), COALESCE(t.year, 0), COALESCE(t.genre, ''),
+	COALESCE(t.duration_ms, 0), COALESCE(t.cover_key, ''),
+	COALESCE(t.bitrate, 0), COALESCE(t.codec, ''), COALESCE(t.sample_rate, 0), COALESCE(t.channels, 0),
+	COALESCE(t.album_id, 0), COALESCE(t.disc_number, 0), t.plays, t.created_at, t.version`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTrack reads the columns in trackColumns. Columns selected after them
+// are scanned into extra.
+func scanTrack(row rowScanner, extra ...interface{}) (*Track, error) {
+	track := &Track{}
+	dest := []interface{}{
+		&track.ID,
+		&track.OwnerID,
+		&track.Name,
+		&track.Artist,
+		&track.URL,
+		&track.Likes,
+		&track.Dislikes,
+		&track.StorageKey,
+		&track.Size,
+		&track.MimeType,
+		&track.Checksum,
+		&track.Album,
+		&track.TrackNumber,
+		&track.Year,
+		&track.Genre,
+		&track.DurationMs,
+		&track.CoverKey,
+		&track.Bitrate,
+		&track.Codec,
+		&track.SampleRate,
+		&track.Channels,
+		&track.AlbumID,
+		&track.DiscNumber,
+		&track.Plays,
+		&track.CreatedAt,
+		&track.Version,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return track, nil
+}
+
 type TrackStorage struct {
 	db *sql.DB
 }
@@ -17,9 +70,51 @@ func NewTrackStorage(db *sql.DB) (*TrackStorage, error) {
 }
 
 func (s *TrackStorage) Create(ctx context.Context, track *Track) (int, error) {
-	const query = `INSERT INTO tracks (name, artist, url, likes, dislikes) VALUES ($1, $2, $3, $4, $5)`
+	const query = `
+		INSERT INTO tracks (
+			owner_id, name, artist, url, storage_key, size, mime_type, checksum,
+			album, track_number, year, genre, duration_ms, cover_key,
+			bitrate, codec, sample_rate, channels, album_id, disc_number
+		)
+		VALUES (
+			NULLIF($1, 0), $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, ''), NULLIF($8, ''),
+			NULLIF($9, ''), NULLIF($10, 0), NULLIF($11, 0), NULLIF($12, ''), NULLIF($13, 0), NULLIF($14, ''),
+			NULLIF($15, 0), NULLIF($16, ''), NULLIF($17, 0), NULLIF($18, 0), NULLIF($19, 0), NULLIF($20, 0)
+		)
+		RETURNING id`
+
 	var id int
-	_, err := s.db.QueryContext(ctx, query, track.Name, track.Artist, track.URL, track.Likes, track.Dislikes)
+	err := withTx(ctx, s.db, func(ctx context.Context) error {
+		err := conn(ctx, s.db).QueryRowContext(
+			ctx,
+			query,
+			track.OwnerID,
+			track.Name,
+			track.Artist,
+			track.URL,
+			track.StorageKey,
+			track.Size,
+			track.MimeType,
+			track.Checksum,
+			track.Album,
+			track.TrackNumber,
+			track.Year,
+			track.Genre,
+			track.DurationMs,
+			track.CoverKey,
+			track.Bitrate,
+			track.Codec,
+			track.SampleRate,
+			track.Channels,
+			track.AlbumID,
+			track.DiscNumber,
+		).Scan(&id)
+		if err != nil {
+			return mapError(err)
+		}
+
+		return indexTrackSuggestions(ctx, s.db, id)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -28,105 +123,267 @@ func (s *TrackStorage) Create(ctx context.Context, track *Track) (int, error) {
 }
 
 func (s *TrackStorage) Get(ctx context.Context, id int) (*Track, error) {
-	const query = `SELECT * FROM tracks WHERE id = $1`
+	const query = `SELECT ` + trackColumns + ` FROM tracks t WHERE t.id = $1`
 
-	track := &Track{}
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&track.ID,
-		&track.Name,
-		&track.Artist,
-		&track.URL,
-		&track.Likes,
-		&track.Dislikes,
-	)
+	track, err := scanTrack(conn(ctx, s.db).QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, domain.NotFound("track")
 		}
-		
+
 		return nil, err
 	}
 
 	return track, nil
 }
 
-func (s *TrackStorage) GetTracks(ctx context.Context, name, artist string, playlistID, offset, limit int) ([]*Track, error) {
-	baseQuery := `SELECT t.id, t.name, t.artist, t.url, t.likes, t.dislikes FROM tracks t`
-	var conditions []string
-	var args []interface{}
+// trackSortKeys maps the sort orders of GetTracks to the expressions they
+// order by. Only these expressions ever reach the ORDER BY clause.
+var trackSortKeys = map[string]string{
+	"name":       "lower(t.name)",
+	"artist":     "lower(t.artist)",
+	"likes":      "t.likes",
+	"created_at": "t.created_at",
+	"duration":   "COALESCE(t.duration_ms, 0)",
+	"plays":      "t.plays",
+}
+
+// GetTracks returns a page of the tracks matching filter, in the order
+// filter.Sort names. Without one, tracks of a playlist come in playlist
+// order, tracks of an album in disc and track order and other tracks in
+// the order they were added.
+func (s *TrackStorage) GetTracks(ctx context.Context, filter *models.TrackFilter, page *models.PageRequest) (*models.Page[*Track], error) {
+	keys, err := trackKeys(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	q := listQuery{columns: trackColumns, from: `FROM tracks t`}
 
-	if name != "" {
-		conditions = append(conditions, "t.name = $"+strconv.Itoa(len(args)+1))
-		args = append(args, name)
+	if filter.Name != "" {
+		q.filter("t.name = ?", filter.Name)
 	}
 
-	if artist != "" {
-		conditions = append(conditions, "t.artist = $"+strconv.Itoa(len(args)+1))
-		args = append(args, artist)
+	// Artists are matched through the credits, so every spelling used in
+	// the artist string of a track finds the same artist.
+	if filter.Artist != "" {
+		q.filter(`EXISTS (
+			SELECT 1 FROM track_artists ta JOIN artists a ON a.id = ta.artist_id
+			WHERE ta.track_id = t.id AND lower(a.name) = lower(?))`, filter.Artist)
 	}
 
-	if playlistID > 0 {
-		baseQuery += ` JOIN playlist_tracks pt ON pt.track_id = t.id`
-		conditions = append(conditions, "pt.playlist_id = $"+strconv.Itoa(len(args)+1))
-		args = append(args, playlistID)
+	if filter.ArtistID > 0 {
+		q.filter(`EXISTS (SELECT 1 FROM track_artists ta WHERE ta.track_id = t.id AND ta.artist_id = ?)`, filter.ArtistID)
 	}
 
-	if len(conditions) > 0 {
-		baseQuery += " WHERE " + strings.Join(conditions, " AND ")
+	if filter.AlbumID > 0 {
+		q.filter("t.album_id = ?", filter.AlbumID)
 	}
 
-	if limit > 0 {
-		baseQuery += " LIMIT $" + strconv.Itoa(len(args)+1)
-		args = append(args, limit)
+	if filter.PlaylistID > 0 {
+		q.from += ` JOIN playlist_tracks pt ON pt.track_id = t.id`
+		q.filter("pt.playlist_id = ?", filter.PlaylistID)
 	}
-	if offset >= 0 {
-		baseQuery += " OFFSET $" + strconv.Itoa(len(args)+1)
-		args = append(args, offset)
+
+	if filter.Genre != "" {
+		q.filter("lower(t.genre) = lower(?)", filter.Genre)
 	}
 
-	rows, err := s.db.QueryContext(ctx, baseQuery, args...)
-	if err != nil {
-		return nil, err
+	if filter.MinLikes > 0 {
+		q.filter("t.likes >= ?", filter.MinLikes)
 	}
-	defer rows.Close()
 
-	var tracks []*Track
-	for rows.Next() {
-		track := &Track{}
-		if err := rows.Scan(&track.ID, &track.Name, &track.Artist, &track.URL, &track.Likes, &track.Dislikes); err != nil {
-			return nil, err
+	if !filter.CreatedAfter.IsZero() {
+		q.filter("t.created_at >= ?", filter.CreatedAfter)
+	}
+
+	if !filter.CreatedBefore.IsZero() {
+		q.filter("t.created_at < ?", filter.CreatedBefore)
+	}
+
+	if filter.DurationGt > 0 {
+		q.filter("t.duration_ms > ?", filter.DurationGt)
+	}
+
+	if filter.DurationLt > 0 {
+		q.filter("t.duration_ms < ?", filter.DurationLt)
+	}
+
+	return queryPage(ctx, conn(ctx, s.db), q, keys, page, scanTrack)
+}
+
+// trackKeys returns the ordering of a track listing. Ties in a sort order
+// are broken by ID, in the same direction. A track can be in a playlist more
+// than once, so in a playlist its entries are told apart by entry ID.
+func trackKeys(filter *models.TrackFilter) (keyset, error) {
+	if filter.Sort != "" {
+		name, desc := strings.CutPrefix(filter.Sort, "-")
+		expr, ok := trackSortKeys[name]
+		if !ok {
+			return nil, domain.Invalid("sort", "must be one of "+strings.Join(models.TrackSorts, ", "))
+		}
+		keys := keyset{{expr: expr, desc: desc}, {expr: "t.id", desc: desc}}
+		if filter.PlaylistID > 0 {
+			keys = append(keys, sortKey{expr: "pt.id", desc: desc})
 		}
-		tracks = append(tracks, track)
+		return keys, nil
+	}
+
+	switch {
+	case filter.PlaylistID > 0:
+		return keyset{{expr: "pt.position"}}, nil
+	case filter.AlbumID > 0:
+		return keyset{
+			{expr: "COALESCE(t.disc_number, 1)"},
+			{expr: "COALESCE(t.track_number, 2147483647)"},
+			{expr: "t.id"},
+		}, nil
+	}
+
+	return keyset{{expr: "t.id"}}, nil
+}
+
+// GetTracksByOwner returns a page of the tracks uploaded by ownerID, newest
+// first.
+func (s *TrackStorage) GetTracksByOwner(ctx context.Context, ownerID int, page *models.PageRequest) (*models.Page[*Track], error) {
+	q := listQuery{
+		columns:    trackColumns,
+		from:       `FROM tracks t`,
+		conditions: []string{"t.owner_id = $1"},
+		args:       []any{ownerID},
 	}
 
-	return tracks, rows.Err()
+	return queryPage(ctx, conn(ctx, s.db), q, keyset{{expr: "t.id", desc: true}}, page, scanTrack)
 }
 
+// Update overwrites the metadata of a track if it is still at track.Version
+// and stores the new version in track.
 func (s *TrackStorage) Update(ctx context.Context, track *Track) error {
-	const query = `UPDATE tracks SET name = $1, artist = $2, url = $3, likes = $4, dislikes = $5 WHERE id = $6`
-	_, err := s.db.ExecContext(
-		ctx,
-		query,
-		track.Name,
-		track.Artist,
-		track.URL,
-		track.Likes,
-		track.Dislikes,
-		track.ID,
-	)
+	const query = `
+		UPDATE tracks
+		SET name = $1, artist = $2, url = $3,
+			album = NULLIF($4, ''), track_number = NULLIF($5, 0), year = NULLIF($6, 0), genre = NULLIF($7, ''),
+			album_id = NULLIF($8, 0), disc_number = NULLIF($9, 0), version = version + 1
+		WHERE id = $10 AND version = $11
+		RETURNING version`
+	return withTx(ctx, s.db, func(ctx context.Context) error {
+		row := conn(ctx, s.db).QueryRowContext(
+			ctx,
+			query,
+			track.Name,
+			track.Artist,
+			track.URL,
+			track.Album,
+			track.TrackNumber,
+			track.Year,
+			track.Genre,
+			track.AlbumID,
+			track.DiscNumber,
+			track.ID,
+			track.Version,
+		)
+
+		version, err := scanVersion(row, "track")
+		if err != nil {
+			return mapError(err)
+		}
+
+		track.Version = version
+		return indexTrackSuggestions(ctx, s.db, track.ID)
+	})
+}
+
+var trackPatchColumns = []string{"name", "artist", "url", "album", "track_number", "year", "genre", "album_id", "disc_number"}
+
+// Patch updates only the columns in changes if the track is still at
+// version, and returns the new version.
+func (s *TrackStorage) Patch(ctx context.Context, id, version int, changes Changes) (int, error) {
+	if len(changes) == 0 {
+		return version, nil
+	}
+
+	clauses, args, err := setClauses(changes, trackPatchColumns...)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	query, args := buildVersionedUpdate("tracks", id, version, clauses, args)
+	err = withTx(ctx, s.db, func(ctx context.Context) error {
+		version, err = scanVersion(conn(ctx, s.db).QueryRowContext(ctx, query, args...), "track")
+		if err != nil {
+			return mapError(err)
+		}
+
+		if !changes.Has("name", "artist") {
+			return nil
+		}
+		return indexTrackSuggestions(ctx, s.db, id)
+	})
+	return version, err
 }
 
-func (s *TrackStorage) Delete(ctx context.Context, id int) error {
-	const query = `DELETE FROM tracks WHERE id = $1`
-	_, err := s.db.ExecContext(ctx, query, id)
+func (s *TrackStorage) UpdateURL(ctx context.Context, id int, url string) error {
+	const query = `UPDATE tracks SET url = $1 WHERE id = $2`
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, url, id)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// AddPlay counts a play of a track. Like the reaction counters, plays do
+// not change the version of the track.
+func (s *TrackStorage) AddPlay(ctx context.Context, id int) error {
+	const query = `UPDATE tracks SET plays = plays + 1 WHERE id = $1`
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+	return err
+}
+
+// Delete removes a track if it is still at version. Its playlist entries go
+// with it, so the playlists it was on are renumbered and move to a new
+// version.
+func (s *TrackStorage) Delete(ctx context.Context, id, version int) error {
+	const playlistsQuery = `SELECT DISTINCT playlist_id FROM playlist_tracks WHERE track_id = $1`
+	const query = `DELETE FROM tracks WHERE id = $1 AND version = $2`
+
+	return withTx(ctx, s.db, func(ctx context.Context) error {
+		rows, err := conn(ctx, s.db).QueryContext(ctx, playlistsQuery, id)
+		if err != nil {
+			return err
+		}
+
+		var playlistIDs []int
+		for rows.Next() {
+			var playlistID int
+			if err := rows.Scan(&playlistID); err != nil {
+				rows.Close()
+				return err
+			}
+			playlistIDs = append(playlistIDs, playlistID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		result, err := conn(ctx, s.db).ExecContext(ctx, query, id, version)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return versionMismatch("track")
+		}
+
+		if len(playlistIDs) == 0 {
+			return nil
+		}
+		return renumberEntries(ctx, s.db, playlistIDs)
+	})
+}
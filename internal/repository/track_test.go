@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"music-hosting/internal/domain"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func newTestTrackStorage(t *testing.T) (*TrackStorage, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	storage, _ := NewTrackStorage(db)
+	return storage, mock
+}
+
+func TestTrackDeleteRenumbersPlaylists(t *testing.T) {
+	storage, mock := newTestTrackStorage(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT DISTINCT playlist_id FROM playlist_tracks WHERE track_id = \$1`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id"}).AddRow(4).AddRow(5))
+	mock.ExpectExec(`DELETE FROM tracks WHERE id = \$1 AND version = \$2`).
+		WithArgs(10, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE playlist_tracks pt SET position = ordered.position .* ROW_NUMBER\(\) OVER \(PARTITION BY playlist_id ORDER BY position\)`).
+		WithArgs(pq.Array([]int{4, 5})).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`UPDATE playlists SET updated_at = NOW\(\), version = version \+ 1`).
+		WithArgs(pq.Array([]int{4, 5})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := storage.Delete(context.Background(), 10, 3); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTrackDeleteVersionMismatch(t *testing.T) {
+	storage, mock := newTestTrackStorage(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT DISTINCT playlist_id FROM playlist_tracks WHERE track_id = \$1`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"playlist_id"}).AddRow(4))
+	mock.ExpectExec(`DELETE FROM tracks WHERE id = \$1 AND version = \$2`).
+		WithArgs(10, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if err := storage.Delete(context.Background(), 10, 2); !errors.Is(err, domain.ErrPreconditionFailed) {
+		t.Errorf("Delete() error = %v, want %v", err, domain.ErrPreconditionFailed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// TxManager runs units of work in a database transaction. Repositories
+// called with the context passed to the unit of work run their statements
+// inside that transaction.
+type TxManager struct {
+	db *sql.DB
+}
+
+func NewTxManager(db *sql.DB) (*TxManager, error) {
+	return &TxManager{db: db}, nil
+}
+
+// WithTx runs fn in a transaction that is committed if fn returns nil and
+// rolled back otherwise. Calls nested in fn join the outer transaction.
+func (m *TxManager) WithTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// conn returns the transaction of the unit of work ctx belongs to, or db
+// outside of one.
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// withTx lets a repository method that writes several statements run them
+// atomically, joining the caller's transaction if there is one.
+func withTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	return (&TxManager{db: db}).WithTx(ctx, fn)
+}
@@ -4,6 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type UserStorage struct {
@@ -15,36 +21,39 @@ func NewUserStorage(db *sql.DB) (*UserStorage, error) {
 }
 
 func (s *UserStorage) Create(ctx context.Context, user *User) (int, error) {
-	const query = `INSERT INTO users (login, email, password_hash, salt) VALUES ($1, $2, $3, $4) RETURNING id`
+	const query = `INSERT INTO users (login, email, password_hash, salt, role) VALUES ($1, $2, $3, $4, $5) RETURNING id`
 	var id int
-	err := s.db.QueryRowContext(
+	err := conn(ctx, s.db).QueryRowContext(
 		ctx,
 		query,
 		user.Login,
 		user.Email,
 		user.Password,
 		user.Salt,
+		user.Role,
 	).Scan(&id)
 
 	if err != nil {
-		return 0, err
+		return 0, mapError(err)
 	}
 
 	return id, nil
 }
 
 func (s *UserStorage) Get(ctx context.Context, id int) (*User, error) {
-	const query = `SELECT id, login, email FROM users WHERE id = $1`
+	const query = `SELECT id, login, email, role, email_verified_at FROM users WHERE id = $1`
 
 	user := &User{}
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Login,
 		&user.Email,
+		&user.Role,
+		&user.EmailVerifiedAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, domain.NotFound("user")
 		}
 		return nil, err
 	}
@@ -52,23 +61,113 @@ func (s *UserStorage) Get(ctx context.Context, id int) (*User, error) {
 	return user, nil
 }
 
+// Update changes the login and email of a user. Passwords are changed with
+// UpdatePassword.
 func (s *UserStorage) Update(ctx context.Context, user *User, id int) error {
-	const query = `UPDATE users SET login = $1, email = $2, password_hash = $3, salt = $4 WHERE id = $5`
+	// A changed email address has to be verified again. Addresses are
+	// compared ignoring case, as everywhere else.
+	const query = `
+		UPDATE users
+		SET login = $1, email = $2,
+			email_verified_at = CASE WHEN lower(email) = lower($2) THEN email_verified_at END
+		WHERE id = $3`
 
-	result, err := s.db.ExecContext(
+	result, err := conn(ctx, s.db).ExecContext(
 		ctx,
 		query,
 		user.Login,
 		user.Email,
-		user.Password,
-		user.Salt,
 		id,
 	)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return requireRow(result, "user")
+}
+
+// GetUserByEmail looks users up by email, ignoring case.
+func (s *UserStorage) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	const query = `SELECT id, login, email FROM users WHERE lower(email) = lower($1) LIMIT 1`
+
+	user := &User{}
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Login, &user.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("user")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// MarkEmailVerified records that the user proved to own email, unless their
+// address has been changed to another one since.
+func (s *UserStorage) MarkEmailVerified(ctx context.Context, id int, email string) error {
+	const query = `
+		UPDATE users SET email_verified_at = NOW()
+		WHERE id = $1 AND lower(email) = lower($2) AND email_verified_at IS NULL`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, id, email)
 	if err != nil {
 		return err
 	}
 
-	_, err = result.RowsAffected()
+	return nil
+}
+
+var userPatchColumns = []string{"login", "email"}
+
+// Patch updates only the columns in changes. A changed email address has to
+// be verified again.
+func (s *UserStorage) Patch(ctx context.Context, id int, changes Changes) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	clauses, args, err := setClauses(changes, userPatchColumns...)
+	if err != nil {
+		return err
+	}
+
+	if email, ok := changes["email"]; ok {
+		args = append(args, email)
+		clauses = append(clauses, "email_verified_at = CASE WHEN lower(email) = lower($"+strconv.Itoa(len(args))+") THEN email_verified_at END")
+	}
+
+	query, args := buildUpdate("users", id, clauses, args)
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, args...)
+	if err != nil {
+		return mapError(err)
+	}
+
+	return requireRow(result, "user")
+}
+
+// GetPasswordHash returns the stored password hash and, for legacy hashes,
+// the salt of a user.
+func (s *UserStorage) GetPasswordHash(ctx context.Context, id int) (string, string, error) {
+	const query = `SELECT password_hash, salt FROM users WHERE id = $1`
+
+	var hash, salt string
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, id).Scan(&hash, &salt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", domain.NotFound("user")
+		}
+		return "", "", err
+	}
+
+	return hash, salt, nil
+}
+
+// UpdatePassword stores a new password hash. The salt column is only used
+// by legacy SHA-256 hashes and is cleared.
+func (s *UserStorage) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	const query = `UPDATE users SET password_hash = $1, salt = '' WHERE id = $2`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, passwordHash, id)
 	if err != nil {
 		return err
 	}
@@ -76,10 +175,10 @@ func (s *UserStorage) Update(ctx context.Context, user *User, id int) error {
 	return nil
 }
 
-func (s *UserStorage) Delete(ctx context.Context, id int) error {
-	const query = `DELETE FROM users WHERE id = $1`
+func (s *UserStorage) UpdateRole(ctx context.Context, id int, role string) error {
+	const query = `UPDATE users SET role = $1 WHERE id = $2`
 
-	_, err := s.db.ExecContext(ctx, query, id)
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, role, id)
 	if err != nil {
 		return err
 	}
@@ -87,47 +186,214 @@ func (s *UserStorage) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
-func (s *UserStorage) GetUsers(ctx context.Context, offset, limit int) ([]*User, error) {
-	const query = `
-        SELECT id, login, email FROM users OFFSET $1 LIMIT $2`
+func (s *UserStorage) Delete(ctx context.Context, id int) error {
+	const query = `DELETE FROM users WHERE id = $1`
 
-	rows, err := s.db.QueryContext(ctx, query, offset, limit)
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	var users []*User
-	for rows.Next() {
+	return requireRow(result, "user")
+}
+
+// GetUsers returns a page of all users in the order they signed up.
+func (s *UserStorage) GetUsers(ctx context.Context, page *models.PageRequest) (*models.Page[*User], error) {
+	q := listQuery{columns: `id, login, email, role`, from: `FROM users`}
+
+	return queryPage(ctx, conn(ctx, s.db), q, keyset{{expr: "id"}}, page, func(row rowScanner, extra ...interface{}) (*User, error) {
 		user := &User{}
-		if err := rows.Scan(
-			&user.ID,
-			&user.Login,
-			&user.Email,
-		); err != nil {
+		dest := []interface{}{&user.ID, &user.Login, &user.Email, &user.Role}
+		if err := row.Scan(append(dest, extra...)...); err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		return user, nil
+	})
+}
+
+func (s *UserStorage) GetUserByLogin(ctx context.Context, login string) (*User, error) {
+	const query = `SELECT id, login, password_hash, salt, role, totp_enabled FROM users WHERE login = $1`
+	user := &User{}
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, login).Scan(
+		&user.ID,
+		&user.Login,
+		&user.Password,
+		&user.Salt,
+		&user.Role,
+		&user.TOTPEnabled,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("user")
+		}
+		return nil, err
 	}
 
-	return users, rows.Err()
+	return user, nil
 }
 
-func (s *UserStorage) GetUserByLogin(ctx context.Context, login string) (*User, error) {
-	const query = `SELECT id, login, password_hash, salt FROM users WHERE login = $1`
+const twoFactorQuery = `
+	SELECT id, login, role, COALESCE(totp_secret, ''), totp_enabled, totp_last_step, totp_failures, totp_failed_at
+	FROM users WHERE id = $1`
+
+// GetTwoFactor returns the user with its TOTP settings.
+func (s *UserStorage) GetTwoFactor(ctx context.Context, id int) (*User, error) {
+	return s.getTwoFactor(ctx, twoFactorQuery, id)
+}
+
+// LockTwoFactor is GetTwoFactor for a unit of work that goes on to check a
+// code: the row stays locked until it ends, so that concurrent attempts are
+// counted one after the other.
+func (s *UserStorage) LockTwoFactor(ctx context.Context, id int) (*User, error) {
+	return s.getTwoFactor(ctx, twoFactorQuery+" FOR UPDATE", id)
+}
+
+func (s *UserStorage) getTwoFactor(ctx context.Context, query string, id int) (*User, error) {
 	user := &User{}
-	err := s.db.QueryRowContext(ctx, query, login).Scan(&user.ID, &user.Login, &user.Password, &user.Salt)
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Login,
+		&user.Role,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastStep,
+		&user.TOTPFailures,
+		&user.TOTPFailedAt,
+	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.NotFound("user")
+		}
 		return nil, err
 	}
 
 	return user, nil
 }
 
+// SetTOTPSecret stores a new, not yet confirmed, TOTP secret.
+func (s *UserStorage) SetTOTPSecret(ctx context.Context, id int, secret string) error {
+	const query = `UPDATE users SET totp_secret = $1, totp_enabled = FALSE, totp_last_step = 0 WHERE id = $2`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, secret, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserStorage) EnableTOTP(ctx context.Context, id int) error {
+	const query = `UPDATE users SET totp_enabled = TRUE WHERE id = $1 AND totp_secret IS NOT NULL`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserStorage) DisableTOTP(ctx context.Context, id int) error {
+	const query = `
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, totp_failures = 0, totp_failed_at = NULL
+		WHERE id = $1`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return s.DeleteRecoveryCodes(ctx, id)
+}
+
+// UseTOTPStep records step as the last accepted TOTP time step. It reports
+// false if a code from the same or a later step was already accepted.
+func (s *UserStorage) UseTOTPStep(ctx context.Context, id int, step int64) (bool, error) {
+	const query = `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, step, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// SetTwoFactorFailures records the number of invalid codes entered for the
+// user and when the last one was.
+func (s *UserStorage) SetTwoFactorFailures(ctx context.Context, id, failures int, failedAt *time.Time) error {
+	const query = `UPDATE users SET totp_failures = $1, totp_failed_at = $2 WHERE id = $3`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, failures, failedAt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores the
+// given hashes instead.
+func (s *UserStorage) ReplaceRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	if err := s.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+
+	const query = `INSERT INTO user_recovery_codes (user_id, code_hash) SELECT $1, UNNEST($2::TEXT[])`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID, pq.Array(hashes))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserStorage) DeleteRecoveryCodes(ctx context.Context, userID int) error {
+	const query = `DELETE FROM user_recovery_codes WHERE user_id = $1`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used. It reports false if
+// the user has no unused code with the given hash.
+func (s *UserStorage) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	const query = `
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM user_recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)`
+
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
 func (s *UserStorage) AddPlaylistsToUser(ctx context.Context, userID int, playlistID int) error {
 	const query = `UPDATE playlists SET user_id = $1 WHERE id = $2`
 
-	_, err := s.db.ExecContext(ctx, query, userID, playlistID)
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID, playlistID)
 	if err != nil {
 		return err
 	}
@@ -138,7 +404,7 @@ func (s *UserStorage) AddPlaylistsToUser(ctx context.Context, userID int, playli
 func (s *UserStorage) RemovePlaylistsFromUser(ctx context.Context, userID int) error {
 	const query = `DELETE FROM playlists WHERE user_id = $1`
 
-	_, err := s.db.ExecContext(ctx, query, userID)
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID)
 	if err != nil {
 		return err
 	}
@@ -149,7 +415,7 @@ func (s *UserStorage) RemovePlaylistsFromUser(ctx context.Context, userID int) e
 func (s *UserStorage) UpdatePlбaylistsForUser(ctx context.Context, userID int) error {
 	const query = `UPDATE playlists SET updated_at = NOW() WHERE user_id = $1`
 
-	_, err := s.db.ExecContext(ctx, query, userID)
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, userID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type UserTokenStorage struct {
+	db *sql.DB
+}
+
+func NewUserTokenStorage(db *sql.DB) (*UserTokenStorage, error) {
+	return &UserTokenStorage{db: db}, nil
+}
+
+// Create stores a token and invalidates any unused token the user already
+// had for the same purpose.
+func (s *UserTokenStorage) Create(ctx context.Context, token *UserToken) error {
+	const invalidate = `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+
+	if _, err := conn(ctx, s.db).ExecContext(ctx, invalidate, token.UserID, token.Purpose); err != nil {
+		return err
+	}
+
+	const query = `
+		INSERT INTO user_tokens (user_id, email, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, token.UserID, token.Email, token.Purpose, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Consume marks an unused, unexpired token as used and returns it, or nil
+// if there is no such token.
+func (s *UserTokenStorage) Consume(ctx context.Context, purpose, hash string) (*UserToken, error) {
+	const query = `
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email, purpose, token_hash, expires_at`
+
+	token := &UserToken{}
+	err := conn(ctx, s.db).QueryRowContext(ctx, query, hash, purpose).Scan(
+		&token.UserID,
+		&token.Email,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
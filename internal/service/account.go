@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"music-hosting/internal/auth"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/mailer"
+	"music-hosting/internal/repository"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	verifyEmailPurpose   = "verify_email"
+	resetPasswordPurpose = "reset_password"
+
+	verifyEmailTokenTTL   = 48 * time.Hour
+	resetPasswordTokenTTL = time.Hour
+)
+
+var (
+	ErrInvalidUserToken     = domain.Invalid("token", "is invalid or expired")
+	ErrEmailNotVerified     = domain.Forbidden("email address is not verified")
+	ErrEmailAlreadyVerified = domain.New(domain.ErrConflict, "email address is already verified")
+)
+
+// SendVerificationEmail sends userID a new email verification link.
+func (s *UserService) SendVerificationEmail(ctx context.Context, userID int) error {
+	user, err := s.userRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	return s.sendVerificationEmail(ctx, user)
+}
+
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		user, err := s.consumeUserToken(ctx, verifyEmailPurpose, token)
+		if err != nil {
+			return err
+		}
+
+		return s.userRepo.MarkEmailVerified(ctx, user.ID, user.Email)
+	})
+}
+
+// RequestPasswordReset emails a reset token to the account registered with
+// email. Unknown addresses are ignored so that the endpoint cannot be used to
+// find out who has an account.
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	if email == "" {
+		return domain.Invalid("email", "is required")
+	}
+
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			s.logger.Info("Password reset requested for unknown email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.issueUserToken(ctx, user, resetPasswordPurpose, resetPasswordTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nsomeone asked to reset the password of your account. "+
+				"Send the token below with your new password to %s/auth/reset-password "+
+				"within an hour:\n\n%s\n\nIf it wasn't you, you can ignore this message.\n",
+			user.Login,
+			s.publicURL,
+			token,
+		),
+	})
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset
+// and ends every session of the account.
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	if password == "" {
+		return domain.Invalid("password", "is required")
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		user, err := s.consumeUserToken(ctx, resetPasswordPurpose, token)
+		if err != nil {
+			return err
+		}
+
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+			return err
+		}
+
+		return s.sessionRepo.RevokeAllForUser(ctx, user.ID)
+	})
+}
+
+func (s *UserService) sendVerificationEmail(ctx context.Context, user *repository.User) error {
+	token, err := s.issueUserToken(ctx, user, verifyEmailPurpose, verifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := s.publicURL + "/auth/verify-email?token=" + url.QueryEscape(token)
+
+	err = s.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nplease confirm your email address by opening this link:\n\n%s\n\n"+
+				"The link is valid for 48 hours.\n",
+			user.Login,
+			link,
+		),
+	})
+	if err != nil {
+		s.logger.Error("Failed to send verification email", slog.Int("userID", user.ID), slog.Any("error", err))
+		return err
+	}
+
+	return nil
+}
+
+// issueUserToken creates a random single-use token to send to the current
+// address of user. Only its hash is stored.
+func (s *UserService) issueUserToken(ctx context.Context, user *repository.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Creating a token invalidates the earlier ones issued for the same
+	// purpose, which must not happen without the new one being stored.
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		return s.tokenRepo.Create(ctx, &repository.UserToken{
+			UserID:    user.ID,
+			Email:     user.Email,
+			Purpose:   purpose,
+			TokenHash: auth.HashOpaqueToken(token),
+			ExpiresAt: time.Now().UTC().Add(ttl),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeUserToken uses up a token issued for purpose and returns the user
+// it was issued to. A token sent to an address the user has changed since
+// proves nothing about the current one and is rejected.
+func (s *UserService) consumeUserToken(ctx context.Context, purpose, token string) (*repository.User, error) {
+	userToken, err := s.tokenRepo.Consume(ctx, purpose, auth.HashOpaqueToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if userToken == nil {
+		return nil, ErrInvalidUserToken
+	}
+
+	user, err := s.userRepo.Get(ctx, userToken.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, ErrInvalidUserToken
+		}
+		return nil, err
+	}
+
+	if !strings.EqualFold(user.Email, userToken.Email) {
+		return nil, ErrInvalidUserToken
+	}
+
+	return user, nil
+}
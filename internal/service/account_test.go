@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"music-hosting/internal/auth"
+	"music-hosting/internal/config"
+	"music-hosting/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestUserService(t *testing.T) (*UserService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	userRepo, _ := repository.NewUserStorage(db)
+	sessionRepo, _ := repository.NewSessionStorage(db)
+	tokenRepo, _ := repository.NewUserTokenStorage(db)
+	tx, _ := repository.NewTxManager(db)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	authCfg := &config.AuthConfig{AccessTokenTTL: time.Minute, KeysDir: t.TempDir()}
+
+	keys, err := auth.NewKeyManager(authCfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewUserService(userRepo, sessionRepo, tokenRepo, tx, keys, nil, authCfg, "", logger), mock
+}
+
+func TestVerifyEmail(t *testing.T) {
+	const token = "token"
+	hash := auth.HashOpaqueToken(token)
+
+	tests := []struct {
+		name string
+		// sentTo is the address the token was issued for, and current the
+		// address of the account when it is used.
+		sentTo, current string
+		wantErr         error
+	}{
+		{name: "same address", sentTo: "alice@example.com", current: "alice@example.com"},
+		{name: "same address in another case", sentTo: "Alice@Example.com", current: "alice@example.com"},
+		{name: "address changed since", sentTo: "alice@example.com", current: "mallory@example.com", wantErr: ErrInvalidUserToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestUserService(t)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`UPDATE user_tokens SET used_at = NOW\(\)`).
+				WithArgs(hash, verifyEmailPurpose).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "email", "purpose", "token_hash", "expires_at"}).
+					AddRow(7, tt.sentTo, verifyEmailPurpose, hash, time.Now().Add(time.Hour)))
+			mock.ExpectQuery(`SELECT id, login, email, role, email_verified_at FROM users`).
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "login", "email", "role", "email_verified_at"}).
+					AddRow(7, "alice", tt.current, "listener", nil))
+			if tt.wantErr == nil {
+				mock.ExpectExec(`UPDATE users SET email_verified_at = NOW\(\)`).
+					WithArgs(7, tt.current).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err := s.VerifyEmail(context.Background(), token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyEmail() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailUnknownToken(t *testing.T) {
+	s, mock := newTestUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE user_tokens SET used_at = NOW\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email", "purpose", "token_hash", "expires_at"}))
+	mock.ExpectRollback()
+
+	if err := s.VerifyEmail(context.Background(), "unknown"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("VerifyEmail() error = %v, want %v", err, ErrInvalidUserToken)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"music-hosting/internal/repository"
+	"music-hosting/internal/storage/blob"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+type AlbumService struct {
+	repo   *repository.AlbumStorage
+	blobs  blob.Store
+	logger *slog.Logger
+}
+
+func NewAlbumService(repo *repository.AlbumStorage, blobs blob.Store, logger *slog.Logger) *AlbumService {
+	return &AlbumService{
+		repo:   repo,
+		blobs:  blobs,
+		logger: logger,
+	}
+}
+
+func (s *AlbumService) CreateAlbum(ctx context.Context, album *models.Album) error {
+	if err := validateAlbum(album); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	repoAlbum := &repository.Album{
+		Title:       album.Title,
+		ArtistID:    album.ArtistID,
+		ReleaseDate: album.ReleaseDate,
+		OwnerID:     album.OwnerID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	id, err := s.repo.Create(ctx, repoAlbum)
+	if err != nil {
+		return err
+	}
+
+	return s.reload(ctx, album, id)
+}
+
+func (s *AlbumService) GetAlbum(ctx context.Context, id int) (*models.Album, error) {
+	repoAlbum, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertAlbum(repoAlbum), nil
+}
+
+// GetAlbums returns a page of the albums, newest release first, optionally
+// only those of artistID or whose title contains title.
+func (s *AlbumService) GetAlbums(ctx context.Context, artistID int, title string, page *models.PageRequest) (*models.Page[*models.Album], error) {
+	repoPage, err := s.repo.GetAlbums(ctx, artistID, title, page)
+	if err != nil {
+		return nil, err
+	}
+
+	var albums []*models.Album
+	for _, repoAlbum := range repoPage.Items {
+		albums = append(albums, convertAlbum(repoAlbum))
+	}
+
+	return pageOf(repoPage, albums), nil
+}
+
+func (s *AlbumService) UpdateAlbum(ctx context.Context, principal *models.Principal, album *models.Album) error {
+	if err := validateAlbum(album); err != nil {
+		return err
+	}
+
+	if _, err := s.getOwnedAlbum(ctx, principal, album.ID); err != nil {
+		return err
+	}
+
+	repoAlbum := &repository.Album{
+		ID:          album.ID,
+		Title:       album.Title,
+		ArtistID:    album.ArtistID,
+		ReleaseDate: album.ReleaseDate,
+		UpdatedAt:   time.Now().UTC(),
+	}
+
+	if err := s.repo.Update(ctx, repoAlbum); err != nil {
+		return err
+	}
+
+	return s.reload(ctx, album, album.ID)
+}
+
+// DeleteAlbum removes an album. Its tracks are kept without an album.
+func (s *AlbumService) DeleteAlbum(ctx context.Context, principal *models.Principal, id int) error {
+	existing, err := s.getOwnedAlbum(ctx, principal, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if existing.CoverKey != "" {
+		s.removeBlob(ctx, existing.CoverKey)
+	}
+
+	return nil
+}
+
+// SetAlbumCover stores image as the cover art of an album, replacing any
+// earlier one.
+func (s *AlbumService) SetAlbumCover(ctx context.Context, principal *models.Principal, id int, image io.Reader) (*models.Album, error) {
+	existing, err := s.getOwnedAlbum(ctx, principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover: %w", err)
+	}
+
+	mime := mimetype.Detect(data)
+	if !strings.HasPrefix(mime.String(), "image/") {
+		return nil, domain.Invalid("file", "has unsupported type "+mime.String())
+	}
+
+	key, err := newStorageKey("covers", mime.Extension())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(data), mime.String()); err != nil {
+		return nil, fmt.Errorf("failed to store cover: %w", err)
+	}
+
+	if err := s.repo.UpdateCover(ctx, id, key); err != nil {
+		s.removeBlob(ctx, key)
+		return nil, err
+	}
+
+	if existing.CoverKey != "" {
+		s.removeBlob(ctx, existing.CoverKey)
+	}
+
+	return s.GetAlbum(ctx, id)
+}
+
+func (s *AlbumService) OpenAlbumCover(ctx context.Context, album *models.Album) (io.ReadSeekCloser, time.Time, error) {
+	notFound := domain.NotFound("cover")
+	if album.CoverKey == "" {
+		return nil, time.Time{}, notFound
+	}
+
+	r, info, err := s.blobs.Get(ctx, album.CoverKey)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			return nil, time.Time{}, notFound
+		}
+		return nil, time.Time{}, err
+	}
+
+	return r, info.ModTime, nil
+}
+
+func (s *AlbumService) getOwnedAlbum(ctx context.Context, principal *models.Principal, id int) (*repository.Album, error) {
+	album, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !principal.CanModify(album.OwnerID) {
+		return nil, domain.Forbidden("only the creator of an album can modify it")
+	}
+
+	return album, nil
+}
+
+// reload copies the stored state of album id, including the name of its
+// artist, into album.
+func (s *AlbumService) reload(ctx context.Context, album *models.Album, id int) error {
+	stored, err := s.GetAlbum(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	*album = *stored
+	return nil
+}
+
+func (s *AlbumService) removeBlob(ctx context.Context, key string) {
+	if err := s.blobs.Delete(ctx, key); err != nil {
+		s.logger.Error("Failed to delete stored file", slog.String("key", key), slog.Any("error", err))
+	}
+}
+
+func validateAlbum(album *models.Album) error {
+	album.Title = strings.TrimSpace(album.Title)
+	if album.Title == "" {
+		return domain.Invalid("title", "is required")
+	}
+
+	return nil
+}
+
+func convertAlbum(album *repository.Album) *models.Album {
+	return &models.Album{
+		ID:          album.ID,
+		Title:       album.Title,
+		ArtistID:    album.ArtistID,
+		ArtistName:  album.ArtistName,
+		ReleaseDate: album.ReleaseDate,
+		CoverKey:    album.CoverKey,
+		OwnerID:     album.OwnerID,
+		CreatedAt:   album.CreatedAt,
+		UpdatedAt:   album.UpdatedAt,
+	}
+}
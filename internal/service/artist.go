@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"music-hosting/internal/repository"
+	"strings"
+	"time"
+)
+
+type ArtistService struct {
+	repo   *repository.ArtistStorage
+	logger *slog.Logger
+}
+
+func NewArtistService(repo *repository.ArtistStorage, logger *slog.Logger) *ArtistService {
+	return &ArtistService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (s *ArtistService) CreateArtist(ctx context.Context, artist *models.Artist) error {
+	artist.Name = strings.TrimSpace(artist.Name)
+	if artist.Name == "" {
+		return domain.Invalid("name", "is required")
+	}
+
+	now := time.Now().UTC()
+	repoArtist := &repository.Artist{
+		Name:      artist.Name,
+		OwnerID:   artist.OwnerID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	id, err := s.repo.Create(ctx, repoArtist)
+	if err != nil {
+		return err
+	}
+
+	artist.ID = id
+	artist.CreatedAt = now
+	artist.UpdatedAt = now
+	return nil
+}
+
+func (s *ArtistService) GetArtist(ctx context.Context, id int) (*models.Artist, error) {
+	repoArtist, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertArtist(repoArtist), nil
+}
+
+// GetArtists returns a page of the artists by name, optionally only those
+// whose name contains name.
+func (s *ArtistService) GetArtists(ctx context.Context, name string, page *models.PageRequest) (*models.Page[*models.Artist], error) {
+	repoPage, err := s.repo.GetArtists(ctx, name, page)
+	if err != nil {
+		return nil, err
+	}
+
+	var artists []*models.Artist
+	for _, repoArtist := range repoPage.Items {
+		artists = append(artists, convertArtist(repoArtist))
+	}
+
+	return pageOf(repoPage, artists), nil
+}
+
+// UpdateArtist renames an artist. Only the user who created the artist and
+// administrators may do so.
+func (s *ArtistService) UpdateArtist(ctx context.Context, principal *models.Principal, artist *models.Artist) error {
+	artist.Name = strings.TrimSpace(artist.Name)
+	if artist.Name == "" {
+		return domain.Invalid("name", "is required")
+	}
+
+	existing, err := s.getOwnedArtist(ctx, principal, artist.ID)
+	if err != nil {
+		return err
+	}
+
+	repoArtist := &repository.Artist{
+		ID:        existing.ID,
+		Name:      artist.Name,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	if err := s.repo.Update(ctx, repoArtist); err != nil {
+		return err
+	}
+
+	artist.OwnerID = existing.OwnerID
+	artist.CreatedAt = existing.CreatedAt
+	artist.UpdatedAt = repoArtist.UpdatedAt
+	return nil
+}
+
+// DeleteArtist removes an artist along with its track credits. Its albums
+// are kept without an artist. An artist that is still the primary artist of
+// a track cannot be deleted.
+func (s *ArtistService) DeleteArtist(ctx context.Context, principal *models.Principal, id int) error {
+	if _, err := s.getOwnedArtist(ctx, principal, id); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *ArtistService) getOwnedArtist(ctx context.Context, principal *models.Principal, id int) (*repository.Artist, error) {
+	artist, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !principal.CanModify(artist.OwnerID) {
+		return nil, domain.Forbidden("only the creator of an artist can modify it")
+	}
+
+	return artist, nil
+}
+
+func convertArtist(artist *repository.Artist) *models.Artist {
+	return &models.Artist{
+		ID:        artist.ID,
+		Name:      artist.Name,
+		OwnerID:   artist.OwnerID,
+		CreatedAt: artist.CreatedAt,
+		UpdatedAt: artist.UpdatedAt,
+	}
+}
@@ -1,26 +1,67 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"music-hosting/internal/auth"
+	"log/slog"
+	"music-hosting/internal/domain"
 	"music-hosting/internal/models"
+	"net/mail"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
 )
 
+// errInvalidCredentials is returned for unknown logins and wrong passwords
+// alike, so that logins cannot be probed.
+var errInvalidCredentials = domain.Unauthorized("invalid login or password")
+
+// dummyPasswordHash is what passwords for unknown logins are checked
+// against, so that rejecting them costs as much as a wrong password and
+// their response time does not give them away.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("dummy password")
+	return hash
+})
+
 func ValidateUser(user *models.User) error {
+	var validation domain.Validation
+
+	validateProfile(&validation, user)
+	if user.Password == "" {
+		validation.Add("password", "is required")
+	}
+
+	return validation.Err()
+}
+
+// ValidateProfile checks the fields of user that can be changed after sign
+// up.
+func ValidateProfile(user *models.User) error {
+	var validation domain.Validation
+
+	validateProfile(&validation, user)
+
+	return validation.Err()
+}
+
+func validateProfile(validation *domain.Validation, user *models.User) {
 	if user.Login == "" {
-		return errors.New("login is required")
+		validation.Add("login", "is required")
 	}
-	if user.Password == "" {
-		return errors.New("password is required")
+	if user.Email == "" {
+		validation.Add("email", "is required")
+	} else if address, err := mail.ParseAddress(user.Email); err != nil || address.Address != user.Email {
+		validation.Add("email", "is not a valid email address")
 	}
-	return nil
 }
 
 func GenerateSalt() ([]byte, error) {
@@ -32,21 +73,112 @@ func GenerateSalt() ([]byte, error) {
 	return salt, nil
 }
 
-func HashPassword(password string) (string, string, error) {
+// Argon2id parameters for new hashes, following the OWASP recommendation of
+// 19 MiB of memory and two passes.
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024
+	argon2Threads = 1
+	argon2KeyLen  = 32
+)
+
+const argon2Prefix = "$argon2id$"
+
+// HashPassword hashes password with Argon2id and returns it in the PHC string
+// format, which embeds the salt and parameters.
+func HashPassword(password string) (string, error) {
 	salt, err := GenerateSalt()
 	if err != nil {
-		return "", "", err
+		return "", err
 	}
 
-	hash := sha256.New()
-	hash.Write(salt)
-	hash.Write([]byte(password))
-	hashedPassword := hash.Sum(nil)
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
 
-	return hex.EncodeToString(hashedPassword), hex.EncodeToString(salt), nil
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix,
+		argon2.Version,
+		argon2Memory,
+		argon2Time,
+		argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
+// CheckPassword verifies password against an Argon2id hash or, for accounts
+// created before Argon2id was introduced, a hex SHA-256 hash and salt.
 func CheckPassword(password, storedHash, storedSalt string) (bool, error) {
+	if strings.HasPrefix(storedHash, argon2Prefix) {
+		return checkArgon2Password(password, storedHash)
+	}
+
+	return checkLegacyPassword(password, storedHash, storedSalt)
+}
+
+// NeedsRehash reports whether storedHash was produced by the legacy scheme or
+// with weaker Argon2id parameters than the current ones.
+func NeedsRehash(storedHash string) bool {
+	params, _, _, err := decodeArgon2Hash(storedHash)
+	if err != nil {
+		return true
+	}
+
+	return params != argon2Params{argon2.Version, argon2Memory, argon2Time, argon2Threads}
+}
+
+type argon2Params struct {
+	version int
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func decodeArgon2Hash(encoded string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &params.version); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+
+	return params, salt, key, nil
+}
+
+func checkArgon2Password(password, storedHash string) (bool, error) {
+	params, salt, key, err := decodeArgon2Hash(storedHash)
+	if err != nil {
+		return false, err
+	}
+
+	if params.version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2id version: %d", params.version)
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func checkLegacyPassword(password, storedHash, storedSalt string) (bool, error) {
 	storedHashBytes, err := hex.DecodeString(storedHash)
 	if err != nil {
 		return false, fmt.Errorf("failed to decode stored hash: %w", err)
@@ -62,41 +194,73 @@ func CheckPassword(password, storedHash, storedSalt string) (bool, error) {
 	hash.Write([]byte(password))
 	computedHash := hash.Sum(nil)
 
-	return bytes.Equal(computedHash, storedHashBytes), nil
+	return subtle.ConstantTimeCompare(computedHash, storedHashBytes) == 1, nil
 }
 
-func (s *UserService) GetToken(ctx context.Context, login string, password string) (string, error) {
+// GetToken checks the user's credentials. Accounts with two-factor
+// authentication get a challenge token to complete with
+// CompleteTwoFactorLogin instead of a token pair.
+func (s *UserService) GetToken(ctx context.Context, login string, password string) (*models.LoginResult, error) {
 	if login == "" || password == "" {
-		return "", fmt.Errorf("invalid login or password")
+		return nil, errInvalidCredentials
 	}
 
 	user, err := s.userRepo.GetUserByLogin(ctx, login)
 	if err != nil {
-		return "", err
+		if errors.Is(err, domain.ErrNotFound) {
+			CheckPassword(password, dummyPasswordHash(), "")
+			return nil, errInvalidCredentials
+		}
+		return nil, err
 	}
 
 	isValidPassword, err := CheckPassword(password, user.Password, user.Salt)
 	if err != nil || !isValidPassword {
-		return "", fmt.Errorf("invalid password")
+		return nil, errInvalidCredentials
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	if NeedsRehash(user.Password) {
+		s.rehashPassword(ctx, user.ID, password)
+	}
+
+	if user.TOTPEnabled {
+		return s.beginTwoFactorLogin(user)
+	}
+
+	tokens, err := s.startSession(ctx, user)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return token, nil
+	return &models.LoginResult{Tokens: tokens}, nil
+}
+
+// rehashPassword upgrades a stored hash to the current scheme. Failures are
+// only logged, since the user has already been authenticated.
+func (s *UserService) rehashPassword(ctx context.Context, userID int, password string) {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		s.logger.Error("Failed to rehash password", slog.Int("userID", userID), slog.Any("error", err))
+		return
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		s.logger.Error("Failed to store rehashed password", slog.Int("userID", userID), slog.Any("error", err))
+	}
 }
 
 func ValidateTrack(track *models.Track) error {
+	var validation domain.Validation
+
 	if track.Name == "" {
-		return errors.New("name is required")
+		validation.Add("name", "is required")
 	}
 	if track.Artist == "" {
-		return errors.New("artist is required")
+		validation.Add("artist", "is required")
 	}
-	if track.URL == "" {
-		return errors.New("url is required")
+	if track.URL == "" && track.StorageKey == "" {
+		validation.Add("url", "is required")
 	}
-	return nil
+
+	return validation.Err()
 }
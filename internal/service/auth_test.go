@@ -0,0 +1,106 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// legacyHash returns the hex SHA-256 hash and salt that accounts created
+// before Argon2id were stored with.
+func legacyHash(password, salt string) (string, string) {
+	sum := sha256.Sum256(append([]byte(salt), password...))
+	return hex.EncodeToString(sum[:]), hex.EncodeToString([]byte(salt))
+}
+
+// argon2Hash encodes an Argon2id hash of password with the given parameters.
+func argon2Hash(password string, version int, memory, time uint32, threads uint8) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		version, memory, time, threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, argon2Prefix) {
+		t.Errorf("HashPassword() = %q, want an Argon2id hash", hash)
+	}
+
+	other, err := HashPassword("secret")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if hash == other {
+		t.Error("HashPassword() returned the same hash twice, want a fresh salt each time")
+	}
+
+	if NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for a hash with the current parameters")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	current, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, legacySalt := legacyHash("secret", "pepper")
+
+	tests := []struct {
+		name        string
+		password    string
+		hash        string
+		salt        string
+		want        bool
+		wantErr     bool
+		needsRehash bool
+	}{
+		{name: "argon2id", password: "secret", hash: current, want: true},
+		{name: "argon2id wrong password", password: "guess", hash: current},
+		{
+			name:        "argon2id with weaker parameters",
+			password:    "secret",
+			hash:        argon2Hash("secret", argon2.Version, 8*1024, 1, 1),
+			want:        true,
+			needsRehash: true,
+		},
+		{
+			name:        "argon2id with another version",
+			password:    "secret",
+			hash:        argon2Hash("secret", argon2.Version-1, argon2Memory, argon2Time, argon2Threads),
+			wantErr:     true,
+			needsRehash: true,
+		},
+		{name: "malformed argon2id", password: "secret", hash: "$argon2id$v=19$garbage", wantErr: true, needsRehash: true},
+		{name: "legacy sha-256", password: "secret", hash: legacy, salt: legacySalt, want: true, needsRehash: true},
+		{name: "legacy wrong password", password: "guess", hash: legacy, salt: legacySalt, needsRehash: true},
+		{name: "legacy wrong salt", password: "secret", hash: legacy, salt: hex.EncodeToString([]byte("salt")), needsRehash: true},
+		{name: "legacy malformed hash", password: "secret", hash: "not hex", salt: legacySalt, wantErr: true, needsRehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckPassword(tt.password, tt.hash, tt.salt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CheckPassword() = %v, want %v", got, tt.want)
+			}
+			if rehash := NeedsRehash(tt.hash); rehash != tt.needsRehash {
+				t.Errorf("NeedsRehash() = %v, want %v", rehash, tt.needsRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package service
+
+import "music-hosting/internal/models"
+
+// pageOf returns a page holding items in place of the items of page, with
+// the same cursors and total.
+func pageOf[R, M any](page *models.Page[R], items []M) *models.Page[M] {
+	return &models.Page[M]{
+		Items: items,
+		Next:  page.Next,
+		Prev:  page.Prev,
+		Total: page.Total,
+	}
+}
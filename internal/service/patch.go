@@ -0,0 +1,27 @@
+package service
+
+import (
+	"music-hosting/internal/models"
+	"music-hosting/internal/repository"
+)
+
+// patchField applies a merge patch member to dst and records the change for
+// column. Null and zero values are stored as NULL, like the NULLIF calls of
+// the full updates do.
+func patchField[T comparable](changes repository.Changes, column string, field models.Field[T], dst *T) {
+	if !field.Set {
+		return
+	}
+
+	var zero T
+	*dst = zero
+	if !field.Null {
+		*dst = field.Value
+	}
+
+	if *dst == zero {
+		changes[column] = nil
+	} else {
+		changes[column] = *dst
+	}
+}
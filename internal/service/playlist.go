@@ -4,26 +4,38 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"music-hosting/internal/domain"
 	"music-hosting/internal/models"
 	"music-hosting/internal/repository"
 	"time"
 )
 
 type PlaylistService struct {
-	repo   *repository.PlaylistStorage
-	logger *slog.Logger
+	repo       *repository.PlaylistStorage
+	artistRepo *repository.ArtistStorage
+	tx         *repository.TxManager
+	logger     *slog.Logger
 }
 
-func NewPlaylistService(repo *repository.PlaylistStorage, logger *slog.Logger) *PlaylistService {
+func NewPlaylistService(
+	repo *repository.PlaylistStorage,
+	artistRepo *repository.ArtistStorage,
+	tx *repository.TxManager,
+	logger *slog.Logger,
+) *PlaylistService {
 	return &PlaylistService{
-		repo:   repo,
-		logger: logger,
+		repo:       repo,
+		artistRepo: artistRepo,
+		tx:         tx,
+		logger:     logger,
 	}
 }
 
-func (s *PlaylistService) CreatePlaylist(ctx context.Context, playlist *models.Playlist) error {
+// CreatePlaylist creates a playlist holding trackIDs, in that order, and
+// returns it.
+func (s *PlaylistService) CreatePlaylist(ctx context.Context, playlist *models.Playlist, trackIDs []int) (*models.Playlist, error) {
 	if playlist.Name == "" {
-		return fmt.Errorf("playlist name is required")
+		return nil, domain.Invalid("name", "is required")
 	}
 
 	repoPlaylist := &repository.Playlist{
@@ -33,12 +45,22 @@ func (s *PlaylistService) CreatePlaylist(ctx context.Context, playlist *models.P
 		UpdatedAt: time.Now().UTC(),
 	}
 
-	err := s.repo.Create(ctx, repoPlaylist)
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, repoPlaylist); err != nil {
+			return err
+		}
+
+		if err := s.repo.InsertTracks(ctx, repoPlaylist.ID, 0, trackIDs); err != nil {
+			return fmt.Errorf("failed to add playlist tracks: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return s.GetPlaylistByID(ctx, repoPlaylist.ID)
 }
 
 func (s *PlaylistService) GetPlaylistByID(ctx context.Context, id int) (*models.Playlist, error) {
@@ -47,121 +69,313 @@ func (s *PlaylistService) GetPlaylistByID(ctx context.Context, id int) (*models.
 		return nil, err
 	}
 
-	if repoPlaylist == nil {
-		return nil, nil
+	playlists, err := s.convertPlaylists(ctx, []*repository.Playlist{repoPlaylist})
+	if err != nil {
+		return nil, err
+	}
+
+	return playlists[0], nil
+}
+
+func (s *PlaylistService) GetPlaylists(ctx context.Context, name string, userID int, page *models.PageRequest) (*models.Page[*models.Playlist], error) {
+	repoPage, err := s.repo.GetPlaylists(ctx, name, userID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	playlists, err := s.convertPlaylists(ctx, repoPage.Items)
+	if err != nil {
+		return nil, err
 	}
 
-	var tracks []*models.Track
-	for _, track := range repoPlaylist.Tracks {
-		tracks = append(tracks, track.ConvertToModel())
+	return pageOf(repoPage, playlists), nil
+}
+
+// convertPlaylists converts repoPlaylists to models and loads the credits of
+// all their tracks in a single query, so that their tracks have the same
+// shape as everywhere else.
+func (s *PlaylistService) convertPlaylists(ctx context.Context, repoPlaylists []*repository.Playlist) ([]*models.Playlist, error) {
+	var trackIDs []int
+	for _, repoPlaylist := range repoPlaylists {
+		for _, repoTrack := range repoPlaylist.Tracks {
+			trackIDs = append(trackIDs, repoTrack.ID)
+		}
 	}
 
+	credits, err := s.artistRepo.GetCredits(ctx, trackIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var playlists []*models.Playlist
+	for _, repoPlaylist := range repoPlaylists {
+		playlists = append(playlists, convertPlaylist(repoPlaylist, credits))
+	}
+
+	return playlists, nil
+}
+
+// convertPlaylist converts repoPlaylist to a model. Its tracks are credited
+// from credits, keyed by track ID.
+func convertPlaylist(repoPlaylist *repository.Playlist, credits map[int][]*repository.Credit) *models.Playlist {
 	playlist := &models.Playlist{
 		ID:        repoPlaylist.ID,
 		Name:      repoPlaylist.Name,
 		UserID:    repoPlaylist.UserID,
-		Tracks:    tracks,
 		CreatedAt: repoPlaylist.CreatedAt,
 		UpdatedAt: repoPlaylist.UpdatedAt,
+		Version:   repoPlaylist.Version,
 	}
 
-	return playlist, nil
+	for _, repoTrack := range repoPlaylist.Tracks {
+		playlist.Tracks = append(playlist.Tracks, convertTrack(repoTrack, credits[repoTrack.ID]))
+		playlist.TotalDurationMs += repoTrack.DurationMs
+	}
+
+	for _, entry := range repoPlaylist.Entries {
+		playlist.Entries = append(playlist.Entries, &models.PlaylistEntry{
+			ID:       entry.ID,
+			Position: entry.Position,
+			TrackID:  entry.TrackID,
+		})
+	}
+
+	return playlist
 }
-func (s *PlaylistService) GetPlaylists(ctx context.Context, name string, userID int) ([]*models.Playlist, error) {
-	repoPlaylists, err := s.repo.GetPlaylists(ctx, name, userID)
+
+// UpdatePlaylistTracks replaces the entries of a playlist with trackIDs, in
+// order. A track listed more than once gets an entry for each occurrence.
+func (s *PlaylistService) UpdatePlaylistTracks(ctx context.Context, playlistID int, newTrackIDs []int) error {
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		return s.repo.ReplaceTracks(ctx, playlistID, newTrackIDs)
+	})
+}
+
+// UpdatePlaylist replaces the name and tracks of a playlist that is still at
+// version and returns the updated playlist.
+func (s *PlaylistService) UpdatePlaylist(ctx context.Context, principal *models.Principal, playlist *models.Playlist, trackIDs []int, version int) (*models.Playlist, error) {
+	if playlist.Name == "" {
+		return nil, domain.Invalid("name", "is required")
+	}
+
+	existing, err := s.getOwnedPlaylist(ctx, principal, playlist.ID, version)
 	if err != nil {
 		return nil, err
 	}
 
-	var playlists []*models.Playlist
-	for _, repoPlaylist := range repoPlaylists {
-		playlist := &models.Playlist{
-			ID:        repoPlaylist.ID,
-			Name:      repoPlaylist.Name,
-			UserID:    repoPlaylist.UserID,
-			CreatedAt: repoPlaylist.CreatedAt,
-			UpdatedAt: repoPlaylist.UpdatedAt,
+	repoPlaylist := &repository.Playlist{
+		ID:        existing.ID,
+		Name:      playlist.Name,
+		UserID:    existing.UserID,
+		UpdatedAt: time.Now().UTC(),
+		Version:   existing.Version,
+	}
+
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, repoPlaylist); err != nil {
+			return fmt.Errorf("failed to update playlist: %w", err)
 		}
 
-		var tracks []*models.Track
-		for _, repoTrack := range repoPlaylist.Tracks {
-			tracks = append(tracks, repoTrack.ConvertToModel())
+		if err := s.UpdatePlaylistTracks(ctx, repoPlaylist.ID, trackIDs); err != nil {
+			return fmt.Errorf("failed to update playlist tracks: %w", err)
 		}
-		playlist.Tracks = tracks
 
-		playlists = append(playlists, playlist)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return playlists, nil
+	return s.GetPlaylistByID(ctx, playlist.ID)
 }
 
-func (s *PlaylistService) UpdatePlaylistTracks(ctx context.Context, playlistID int, newTrackIDs []int) error {
-	existingTrackIDs, err := s.repo.GetExistingTracks(ctx, playlistID)
+// PatchPlaylist applies a merge patch to a playlist that is still at
+// version. Its tracks are only replaced if the patch lists them; null
+// removes every track.
+func (s *PlaylistService) PatchPlaylist(ctx context.Context, principal *models.Principal, id, version int, patch *models.PlaylistPatch) (*models.Playlist, error) {
+	existing, err := s.getOwnedPlaylist(ctx, principal, id, version)
 	if err != nil {
-		return fmt.Errorf("failed to get existing tracks: %w", err)
+		return nil, err
 	}
 
-	toDelete := difference(existingTrackIDs, newTrackIDs)
-	toAdd := difference(newTrackIDs, existingTrackIDs)
+	changes := repository.Changes{}
 
-	if len(toDelete) > 0 {
-		if err := s.repo.DeleteTracks(ctx, playlistID, toDelete); err != nil {
-			return fmt.Errorf("failed to delete tracks: %w", err)
+	if patch.Name.Set {
+		if patch.Name.Null || patch.Name.Value == "" {
+			return nil, domain.Invalid("name", "is required")
 		}
+		changes["name"] = patch.Name.Value
+	}
+
+	if patch.Name.Set || patch.TrackIDs.Set {
+		changes["updated_at"] = time.Now().UTC()
 	}
 
-	if len(toAdd) > 0 {
-		if err := s.repo.AddTracks(ctx, playlistID, toAdd); err != nil {
-			return fmt.Errorf("failed to add tracks: %w", err)
+	// The version check guards the track list too, so the playlist row is
+	// updated first.
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.Patch(ctx, id, existing.Version, changes); err != nil {
+			return err
+		}
+
+		if patch.TrackIDs.Set {
+			if err := s.UpdatePlaylistTracks(ctx, id, patch.TrackIDs.Value); err != nil {
+				return fmt.Errorf("failed to update playlist tracks: %w", err)
+			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return s.GetPlaylistByID(ctx, id)
 }
 
-func (s *PlaylistService) UpdatePlaylist(ctx context.Context, playlist *models.Playlist, trackIDs []int) error {
-	if playlist.Name == "" {
-		return fmt.Errorf("playlist name is required")
+// InsertPlaylistTracks adds trackIDs before the entry at position, or at
+// the end if position is nil, to a playlist that is still at version.
+func (s *PlaylistService) InsertPlaylistTracks(ctx context.Context, principal *models.Principal, id, version int, trackIDs []int, position *int) (*models.Playlist, error) {
+	if len(trackIDs) == 0 {
+		return nil, domain.Invalid("tracks_id", "is required")
 	}
 
-	repoPlaylist := &repository.Playlist{
-		ID:        playlist.ID,
-		Name:      playlist.Name,
-		UserID:    playlist.UserID,
-		UpdatedAt: time.Now().UTC(),
+	err := s.editEntries(ctx, principal, id, version, func(ctx context.Context, entryIDs []int) error {
+		at := len(entryIDs)
+		if position != nil {
+			if *position < 0 || *position > len(entryIDs) {
+				return domain.Invalid("position", fmt.Sprintf("must be between 0 and %d", len(entryIDs)))
+			}
+			at = *position
+		}
+
+		return s.repo.InsertTracks(ctx, id, at, trackIDs)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.repo.Update(ctx, repoPlaylist); err != nil {
-		return fmt.Errorf("failed to update playlist: %w", err)
+	return s.GetPlaylistByID(ctx, id)
+}
+
+// MovePlaylistTracks moves rangeLength entries starting at rangeStart so
+// that they come before the entry that was at insertBefore.
+func (s *PlaylistService) MovePlaylistTracks(ctx context.Context, principal *models.Principal, id, version, rangeStart, rangeLength, insertBefore int) (*models.Playlist, error) {
+	if rangeLength == 0 {
+		rangeLength = 1
 	}
 
-	if err := s.UpdatePlaylistTracks(ctx, repoPlaylist.ID, trackIDs); err != nil {
-		return fmt.Errorf("failed to update playlist tracks: %w", err)
+	err := s.editEntries(ctx, principal, id, version, func(ctx context.Context, entryIDs []int) error {
+		var validation domain.Validation
+		if rangeStart < 0 || rangeStart >= len(entryIDs) {
+			validation.Add("range_start", "is out of range")
+		} else if rangeLength < 1 || rangeStart+rangeLength > len(entryIDs) {
+			validation.Add("range_length", "is out of range")
+		}
+		if insertBefore < 0 || insertBefore > len(entryIDs) {
+			validation.Add("insert_before", fmt.Sprintf("must be between 0 and %d", len(entryIDs)))
+		}
+		if err := validation.Err(); err != nil {
+			return err
+		}
+
+		return s.repo.SetEntryOrder(ctx, id, moveRange(entryIDs, rangeStart, rangeLength, insertBefore))
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return s.GetPlaylistByID(ctx, id)
 }
 
-func difference(slice1, slice2 []int) []int {
-	m := make(map[int]struct{})
-	for _, v := range slice2 {
-		m[v] = struct{}{}
+// RemovePlaylistEntry removes a single entry from a playlist that is still
+// at version. Other entries for the same track are kept.
+func (s *PlaylistService) RemovePlaylistEntry(ctx context.Context, principal *models.Principal, id, version, entryID int) (*models.Playlist, error) {
+	err := s.editEntries(ctx, principal, id, version, func(ctx context.Context, _ []int) error {
+		return s.repo.RemoveEntry(ctx, id, entryID)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	var diff []int
-	for _, v := range slice1 {
-		if _, found := m[v]; !found {
-			diff = append(diff, v)
+	return s.GetPlaylistByID(ctx, id)
+}
+
+// editEntries runs fn with the current entry IDs of an owned playlist in a
+// transaction that also moves the playlist to a new version, so that
+// positions computed by the client cannot be applied to a list that has
+// changed since it was read.
+func (s *PlaylistService) editEntries(ctx context.Context, principal *models.Principal, id, version int, fn func(ctx context.Context, entryIDs []int) error) error {
+	existing, err := s.getOwnedPlaylist(ctx, principal, id, version)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		changes := repository.Changes{"updated_at": time.Now().UTC()}
+		if _, err := s.repo.Patch(ctx, id, existing.Version, changes); err != nil {
+			return err
+		}
+
+		entryIDs, err := s.repo.GetEntryIDs(ctx, id)
+		if err != nil {
+			return err
 		}
+
+		return fn(ctx, entryIDs)
+	})
+}
+
+// moveRange returns ids with the length elements starting at start moved
+// in front of the element at insertBefore.
+func moveRange(ids []int, start, length, insertBefore int) []int {
+	moved := ids[start : start+length]
+
+	rest := make([]int, 0, len(ids)-length)
+	rest = append(rest, ids[:start]...)
+	rest = append(rest, ids[start+length:]...)
+
+	if insertBefore > start {
+		insertBefore = max(insertBefore-length, start)
 	}
-	return diff
+
+	result := make([]int, 0, len(ids))
+	result = append(result, rest[:insertBefore]...)
+	result = append(result, moved...)
+	result = append(result, rest[insertBefore:]...)
+	return result
 }
 
-func (s *PlaylistService) DeletePlaylist(ctx context.Context, id int) error {
-	err := s.repo.Delete(ctx, id)
+func (s *PlaylistService) DeletePlaylist(ctx context.Context, principal *models.Principal, id, version int) error {
+	existing, err := s.getOwnedPlaylist(ctx, principal, id, version)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.Delete(ctx, id, existing.Version)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// getOwnedPlaylist loads the playlist with the given id and checks that it
+// belongs to principal, unless principal is an administrator, and that it is
+// still at version.
+func (s *PlaylistService) getOwnedPlaylist(ctx context.Context, principal *models.Principal, id, version int) (*repository.Playlist, error) {
+	playlist, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !principal.CanModify(playlist.UserID) {
+		return nil, domain.Forbidden("only the owner of a playlist can modify it")
+	}
+
+	if err := domain.CheckVersion("playlist", playlist.Version, version); err != nil {
+		return nil, err
+	}
+
+	return playlist, nil
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"music-hosting/internal/models"
+	"music-hosting/internal/repository"
+	"reflect"
+	"testing"
+)
+
+func TestConvertPlaylistCreditsTracks(t *testing.T) {
+	repoPlaylist := &repository.Playlist{
+		ID:     1,
+		Tracks: []*repository.Track{{ID: 10, DurationMs: 1000}, {ID: 11, DurationMs: 2000}},
+	}
+	credits := map[int][]*repository.Credit{
+		10: {{TrackID: 10, ArtistID: 3, Name: "Artist", Role: models.CreditPrimary}},
+	}
+
+	playlist := convertPlaylist(repoPlaylist, credits)
+
+	want := []*models.Credit{{ArtistID: 3, Name: "Artist", Role: models.CreditPrimary}}
+	if !reflect.DeepEqual(playlist.Tracks[0].Artists, want) {
+		t.Errorf("artists of a credited track = %+v, want %+v", playlist.Tracks[0].Artists, want)
+	}
+	if artists := playlist.Tracks[1].Artists; artists == nil || len(artists) != 0 {
+		t.Errorf("artists of an uncredited track = %#v, want an empty list", artists)
+	}
+	if playlist.TotalDurationMs != 3000 {
+		t.Errorf("TotalDurationMs = %d, want 3000", playlist.TotalDurationMs)
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"music-hosting/internal/repository"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 50
+	maxSearchLength    = 200
+
+	defaultSuggestLimit = 5
+	maxSuggestLimit     = 10
+	// suggestTimeout bounds the time spent on a suggestion. Another keystroke
+	// usually follows, so a late answer is worth less than none.
+	suggestTimeout = 300 * time.Millisecond
+)
+
+type SearchService struct {
+	repo       *repository.SearchStorage
+	artistRepo *repository.ArtistStorage
+	logger     *slog.Logger
+}
+
+func NewSearchService(repo *repository.SearchStorage, artistRepo *repository.ArtistStorage, logger *slog.Logger) *SearchService {
+	return &SearchService{
+		repo:       repo,
+		artistRepo: artistRepo,
+		logger:     logger,
+	}
+}
+
+// Search looks text up in the names of tracks, artists, albums and
+// playlists, ignoring case and accents and tolerating typos. Only the
+// sections listed in types are searched, all of them if types is empty.
+// Each section holds at most limit hits, best matches first.
+func (s *SearchService) Search(ctx context.Context, text string, types []string, limit int) (*models.SearchResults, error) {
+	text = strings.TrimSpace(text)
+	v := &domain.Validation{}
+	if text == "" {
+		v.Add("q", "is required")
+	} else if utf8.RuneCountInString(text) > maxSearchLength {
+		v.Add("q", "is too long")
+	}
+	for _, t := range types {
+		if !slices.Contains(models.SearchTypes, t) {
+			v.Add("type", "must be one of "+strings.Join(models.SearchTypes, ", "))
+			break
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(types) == 0 {
+		types = models.SearchTypes
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	results := &models.SearchResults{}
+	for _, t := range types {
+		var err error
+		switch t {
+		case models.SearchTracks:
+			results.Tracks, err = s.searchTracks(ctx, text, limit)
+		case models.SearchArtists:
+			results.Artists, err = searchSection(ctx, text, limit, s.repo.SearchArtists, convertArtist)
+		case models.SearchAlbums:
+			results.Albums, err = searchSection(ctx, text, limit, s.repo.SearchAlbums, convertAlbum)
+		case models.SearchPlaylists:
+			// Playlist hits come without their tracks, so there is nothing
+			// to credit.
+			results.Playlists, err = searchSection(ctx, text, limit, s.repo.SearchPlaylists, func(p *repository.Playlist) *models.Playlist {
+				return convertPlaylist(p, nil)
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// searchTracks is the tracks section. Its hits are credited the same way as
+// the tracks of every other listing.
+func (s *SearchService) searchTracks(ctx context.Context, text string, limit int) ([]*models.SearchHit[*models.Track], error) {
+	var credits map[int][]*repository.Credit
+	search := func(ctx context.Context, text string, limit int) ([]*repository.Hit[*repository.Track], error) {
+		hits, err := s.repo.SearchTracks(ctx, text, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make([]int, 0, len(hits))
+		for _, hit := range hits {
+			ids = append(ids, hit.Item.ID)
+		}
+
+		credits, err = s.artistRepo.GetCredits(ctx, ids)
+		return hits, err
+	}
+
+	return searchSection(ctx, text, limit, search, func(track *repository.Track) *models.Track {
+		return convertTrack(track, credits[track.ID])
+	})
+}
+
+// searchSection runs one of the repository searches and converts its hits.
+// The result is never nil so that requested sections are always present in
+// the response.
+func searchSection[R, M any](
+	ctx context.Context,
+	text string,
+	limit int,
+	search func(context.Context, string, int) ([]*repository.Hit[R], error),
+	convert func(R) M,
+) ([]*models.SearchHit[M], error) {
+	repoHits, err := search(ctx, text, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]*models.SearchHit[M], 0, len(repoHits))
+	for _, repoHit := range repoHits {
+		hits = append(hits, &models.SearchHit[M]{
+			Item:      convert(repoHit.Item),
+			Score:     repoHit.Score,
+			Highlight: repoHit.Highlight,
+		})
+	}
+
+	return hits, nil
+}
+
+// Suggest returns track names, artists and playlist names that start with
+// prefix, at most limit of each. If the lookup does not finish within
+// suggestTimeout, no suggestions are returned.
+func (s *SearchService) Suggest(ctx context.Context, prefix string, limit int) (*models.Suggestions, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return nil, domain.Invalid("q", "is required")
+	}
+	if utf8.RuneCountInString(prefix) > maxSearchLength {
+		return nil, domain.Invalid("q", "is too long")
+	}
+
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	limit = min(limit, maxSuggestLimit)
+
+	ctx, cancel := context.WithTimeout(ctx, suggestTimeout)
+	defer cancel()
+
+	suggestions := &models.Suggestions{}
+	repoSuggestions, err := s.repo.Suggest(ctx, prefix, limit)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			s.logger.Warn("Search suggestions timed out", slog.String("prefix", prefix))
+			return suggestions, nil
+		}
+		return nil, err
+	}
+
+	for _, repoSuggestion := range repoSuggestions {
+		suggestion := &models.Suggestion{ID: repoSuggestion.ID, Text: repoSuggestion.Label}
+		switch repoSuggestion.Kind {
+		case "track":
+			suggestions.Tracks = append(suggestions.Tracks, suggestion)
+		case "artist":
+			suggestions.Artists = append(suggestions.Artists, suggestion)
+		case "playlist":
+			suggestions.Playlists = append(suggestions.Playlists, suggestion)
+		}
+	}
+
+	return suggestions, nil
+}
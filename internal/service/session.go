@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"music-hosting/internal/auth"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"music-hosting/internal/repository"
+	"time"
+)
+
+var ErrInvalidRefreshToken = domain.Unauthorized("invalid or expired refresh token")
+
+func (s *UserService) RefreshToken(ctx context.Context, refreshToken string) (*models.Tokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	hash := auth.HashOpaqueToken(refreshToken)
+	session, err := s.sessionRepo.GetActiveByRefreshHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, s.rejectRefreshToken(ctx, hash)
+	}
+
+	user, err := s.userRepo.Get(ctx, session.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	newRefreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().UTC().Add(s.authCfg.RefreshTokenTTL)
+	rotated, err := s.sessionRepo.Rotate(ctx, session.ID, hash, auth.HashOpaqueToken(newRefreshToken), expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rotated {
+		return nil, s.rejectRefreshToken(ctx, hash)
+	}
+
+	return s.issueAccessToken(user, session.ID, newRefreshToken)
+}
+
+// rejectRefreshToken refuses a refresh token that is not the current one of
+// an active session. A token that has already been rotated out is being
+// replayed, possibly by someone who stole it, so its session is revoked
+// and neither copy of the token can be used again.
+func (s *UserService) rejectRefreshToken(ctx context.Context, hash string) error {
+	revoked, err := s.sessionRepo.RevokeByRetiredRefreshHash(ctx, hash)
+	if err != nil {
+		return err
+	}
+
+	if revoked {
+		s.logger.Warn("Revoked a session after its refresh token was reused")
+	}
+
+	return ErrInvalidRefreshToken
+}
+
+func (s *UserService) Logout(ctx context.Context, sessionID int) error {
+	return s.sessionRepo.Revoke(ctx, sessionID)
+}
+
+func (s *UserService) LogoutAll(ctx context.Context, userID int) error {
+	return s.sessionRepo.RevokeAllForUser(ctx, userID)
+}
+
+func (s *UserService) IsSessionActive(ctx context.Context, sessionID int) (bool, error) {
+	return s.sessionRepo.IsActive(ctx, sessionID)
+}
+
+// startSession creates a session for user and issues its first token pair.
+func (s *UserService) startSession(ctx context.Context, user *repository.User) (*models.Tokens, error) {
+	refreshToken, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &repository.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: auth.HashOpaqueToken(refreshToken),
+		ExpiresAt:        time.Now().UTC().Add(s.authCfg.RefreshTokenTTL),
+	}
+
+	sessionID, err := s.sessionRepo.Create(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueAccessToken(user, sessionID, refreshToken)
+}
+
+func (s *UserService) issueAccessToken(user *repository.User, sessionID int, refreshToken string) (*models.Tokens, error) {
+	accessToken, err := s.keys.GenerateToken(user.ID, user.Role, sessionID, s.authCfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    s.authCfg.AccessTokenTTL,
+	}, nil
+}
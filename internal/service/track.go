@@ -1,45 +1,204 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/media"
 	"music-hosting/internal/models"
 	"music-hosting/internal/repository"
+	"music-hosting/internal/storage/blob"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	ErrTrackNotHosted  = domain.New(domain.ErrNotFound, "track file is not hosted by this service")
+	ErrInvalidReaction = domain.Invalid("value", "must be either like or dislike")
 )
 
 type TrackService struct {
-	trackRepo *repository.TrackStorage
-	logger    *slog.Logger
+	trackRepo    *repository.TrackStorage
+	reactionRepo *repository.ReactionStorage
+	userRepo     *repository.UserStorage
+	artistRepo   *repository.ArtistStorage
+	albumRepo    *repository.AlbumStorage
+	tx           *repository.TxManager
+	blobs        blob.Store
+	logger       *slog.Logger
 }
 
-func NewTrackService(trackRepo *repository.TrackStorage, logger *slog.Logger) *TrackService {
+func NewTrackService(
+	trackRepo *repository.TrackStorage,
+	reactionRepo *repository.ReactionStorage,
+	userRepo *repository.UserStorage,
+	artistRepo *repository.ArtistStorage,
+	albumRepo *repository.AlbumStorage,
+	tx *repository.TxManager,
+	blobs blob.Store,
+	logger *slog.Logger,
+) *TrackService {
 	return &TrackService{
-		trackRepo: trackRepo,
-		logger:    logger,
+		trackRepo:    trackRepo,
+		reactionRepo: reactionRepo,
+		userRepo:     userRepo,
+		artistRepo:   artistRepo,
+		albumRepo:    albumRepo,
+		tx:           tx,
+		blobs:        blobs,
+		logger:       logger,
 	}
 }
 
-func (s *TrackService) CreateTrack(ctx context.Context, track *models.Track) error {
+// CreateTrack stores a track whose audio is hosted elsewhere and returns it
+// as stored.
+func (s *TrackService) CreateTrack(ctx context.Context, track *models.Track) (*models.Track, error) {
+	if err := s.requireVerifiedEmail(ctx, track.OwnerID); err != nil {
+		return nil, err
+	}
+
 	err := ValidateTrack(track)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	repoTrack := repository.Track{
-		Name:     track.Name,
-		Artist:   track.Artist,
-		URL:      track.URL,
-		Likes:    track.Likes,
-		Dislikes: track.Dislikes,
+		OwnerID:     track.OwnerID,
+		Name:        track.Name,
+		Artist:      track.Artist,
+		URL:         track.URL,
+		Album:       track.Album,
+		TrackNumber: track.TrackNumber,
+		Year:        track.Year,
+		Genre:       track.Genre,
+		DiscNumber:  track.DiscNumber,
 	}
 
-	id, err := s.trackRepo.Create(ctx, &repoTrack)
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		return s.insertTrack(ctx, track, &repoTrack)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	track.ID = id
-	return nil
+	return s.GetTrackByID(ctx, track.ID)
+}
+
+// UploadTrack stores an audio file along with a track for it and returns the
+// track as stored.
+func (s *TrackService) UploadTrack(ctx context.Context, track *models.Track, audio io.ReadSeeker) (*models.Track, error) {
+	if err := s.requireVerifiedEmail(ctx, track.OwnerID); err != nil {
+		return nil, err
+	}
+
+	mime, err := mimetype.DetectReader(audio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect file type: %w", err)
+	}
+
+	if !isAudio(mime) {
+		return nil, domain.Invalid("file", "has unsupported type "+mime.String())
+	}
+
+	if _, err := audio.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	tags, err := media.ReadTags(audio)
+	if err != nil {
+		s.logger.Warn("Failed to read audio tags", slog.Any("error", err))
+		tags = &media.Tags{}
+	}
+	applyTags(track, tags)
+
+	info, err := media.Probe(audio)
+	if err != nil {
+		s.logger.Warn("Failed to read audio properties", slog.Any("error", err))
+	} else {
+		applyAudioInfo(track, info)
+	}
+
+	key, err := newStorageKey("tracks", mime.Extension())
+	if err != nil {
+		return nil, err
+	}
+
+	track.StorageKey = key
+	track.MimeType = mime.String()
+
+	err = ValidateTrack(track)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := audio.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err := s.blobs.Put(ctx, key, io.TeeReader(audio, io.MultiWriter(hash, counter)), track.MimeType); err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	track.Size = counter.n
+	track.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	if tags.Picture != nil {
+		track.CoverKey = s.storeCover(ctx, tags.Picture)
+	}
+
+	repoTrack := repository.Track{
+		OwnerID:     track.OwnerID,
+		Name:        track.Name,
+		Artist:      track.Artist,
+		StorageKey:  track.StorageKey,
+		Size:        track.Size,
+		MimeType:    track.MimeType,
+		Checksum:    track.Checksum,
+		Album:       track.Album,
+		TrackNumber: track.TrackNumber,
+		Year:        track.Year,
+		Genre:       track.Genre,
+		DurationMs:  track.DurationMs,
+		CoverKey:    track.CoverKey,
+		Bitrate:     track.Bitrate,
+		Codec:       track.Codec,
+		SampleRate:  track.SampleRate,
+		Channels:    track.Channels,
+		DiscNumber:  track.DiscNumber,
+	}
+
+	// The stream URL contains the id, so it is only known once the row
+	// exists.
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.insertTrack(ctx, track, &repoTrack); err != nil {
+			return err
+		}
+
+		track.URL = streamURL(track.ID)
+		return s.trackRepo.UpdateURL(ctx, track.ID, track.URL)
+	})
+	if err != nil {
+		track.ID = 0
+		track.URL = ""
+		s.removeBlob(ctx, key)
+		if track.CoverKey != "" {
+			s.removeBlob(ctx, track.CoverKey)
+		}
+		return nil, err
+	}
+
+	return s.GetTrackByID(ctx, track.ID)
 }
 
 func (s *TrackService) GetTrackByID(ctx context.Context, id int) (*models.Track, error) {
@@ -47,68 +206,685 @@ func (s *TrackService) GetTrackByID(ctx context.Context, id int) (*models.Track,
 	if err != nil {
 		return nil, err
 	}
-	track := &models.Track{
-		ID:       repoTrack.ID,
-		Name:     repoTrack.Name,
-		Artist:   repoTrack.Artist,
-		URL:      repoTrack.URL,
-		Likes:    repoTrack.Likes,
-		Dislikes: repoTrack.Dislikes,
+
+	tracks, err := s.convertTracks(ctx, []*repository.Track{repoTrack})
+	if err != nil {
+		return nil, err
 	}
 
-	return track, nil
+	return tracks[0], nil
 }
 
-func (s *TrackService) UpdateTrack(ctx context.Context, track *models.Track) error {
-	err := ValidateTrack(track)
+func (s *TrackService) OpenTrackAudio(ctx context.Context, track *models.Track) (io.ReadSeekCloser, time.Time, error) {
+	return s.openBlob(ctx, track.StorageKey)
+}
+
+// RecordPlay counts a play of a track.
+func (s *TrackService) RecordPlay(ctx context.Context, id int) error {
+	return s.trackRepo.AddPlay(ctx, id)
+}
+
+func (s *TrackService) OpenTrackCover(ctx context.Context, track *models.Track) (io.ReadSeekCloser, time.Time, error) {
+	return s.openBlob(ctx, track.CoverKey)
+}
+
+// UpdateTrack overwrites the metadata of a track that is still at version
+// and returns the updated track.
+func (s *TrackService) UpdateTrack(ctx context.Context, principal *models.Principal, track *models.Track, version int) (*models.Track, error) {
+	existing, err := s.getOwnedTrack(ctx, principal, track.ID, version)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if existing.StorageKey != "" {
+		track.URL = existing.URL
+	}
+
+	err = ValidateTrack(track)
+	if err != nil {
+		return nil, err
+	}
+
+	// The album string follows the album of the track. Taking the track off
+	// its album clears the string, unless a new one is given.
+	switch {
+	case track.AlbumID != 0:
+		album, err := s.getAlbum(ctx, track.AlbumID)
+		if err != nil {
+			return nil, err
+		}
+		track.Album = album.Title
+	case existing.AlbumID != 0 && track.Album == existing.Album:
+		track.Album = ""
 	}
 
 	trackRepo := repository.Track{
-		ID:       track.ID,
-		Name:     track.Name,
-		Artist:   track.Artist,
-		URL:      track.URL,
+		ID:          track.ID,
+		Name:        track.Name,
+		Artist:      track.Artist,
+		URL:         track.URL,
+		Album:       track.Album,
+		TrackNumber: track.TrackNumber,
+		Year:        track.Year,
+		Genre:       track.Genre,
+		AlbumID:     track.AlbumID,
+		DiscNumber:  track.DiscNumber,
+		Version:     existing.Version,
+	}
+
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.trackRepo.Update(ctx, &trackRepo); err != nil {
+			return err
+		}
+
+		if track.Artist != existing.Artist {
+			return s.setPrimaryArtist(ctx, track.ID, track.Artist, existing.OwnerID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetTrackByID(ctx, track.ID)
+}
+
+// PatchTrack applies a merge patch to the metadata of a track that is still
+// at version and returns the updated track. The URL of uploaded tracks
+// cannot be changed.
+func (s *TrackService) PatchTrack(ctx context.Context, principal *models.Principal, id, version int, patch *models.TrackPatch) (*models.Track, error) {
+	existing, err := s.getOwnedTrack(ctx, principal, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.URL.Set && existing.StorageKey != "" {
+		return nil, domain.Invalid("url", "cannot be changed for uploaded tracks")
+	}
+
+	track := existing.ConvertToModel()
+
+	changes := repository.Changes{}
+	patchField(changes, "name", patch.Name, &track.Name)
+	patchField(changes, "artist", patch.Artist, &track.Artist)
+	patchField(changes, "url", patch.URL, &track.URL)
+	patchField(changes, "album", patch.Album, &track.Album)
+	patchField(changes, "track_number", patch.TrackNumber, &track.TrackNumber)
+	patchField(changes, "year", patch.Year, &track.Year)
+	patchField(changes, "genre", patch.Genre, &track.Genre)
+	patchField(changes, "album_id", patch.AlbumID, &track.AlbumID)
+	patchField(changes, "disc_number", patch.DiscNumber, &track.DiscNumber)
+
+	if err := ValidateTrack(track); err != nil {
+		return nil, err
+	}
+
+	// The album string follows the album the track is moved to. Taking the
+	// track off its album clears the string, unless the patch sets one.
+	switch {
+	case patch.AlbumID.Set && track.AlbumID != 0:
+		album, err := s.getAlbum(ctx, track.AlbumID)
+		if err != nil {
+			return nil, err
+		}
+		track.Album = album.Title
+		changes["album"] = album.Title
+	case patch.AlbumID.Set && existing.AlbumID != 0 && !patch.Album.Set:
+		track.Album = ""
+		changes["album"] = ""
+	}
+
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := s.trackRepo.Patch(ctx, id, existing.Version, changes); err != nil {
+			return err
+		}
+
+		if track.Artist != existing.Artist {
+			return s.setPrimaryArtist(ctx, id, track.Artist, existing.OwnerID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetTrackByID(ctx, id)
+}
+
+// SetTrackArtists replaces the artists credited on a track that is still at
+// version and returns the updated track.
+func (s *TrackService) SetTrackArtists(ctx context.Context, principal *models.Principal, id, version int, credits []*models.Credit) (*models.Track, error) {
+	if err := validateCredits(credits); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.getOwnedTrack(ctx, principal, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	repoCredits := make([]*repository.Credit, 0, len(credits))
+	var primaryField string
+	var primaryID int
+	for i, credit := range credits {
+		repoCredits = append(repoCredits, &repository.Credit{
+			TrackID:  id,
+			ArtistID: credit.ArtistID,
+			Role:     credit.Role,
+		})
+		if credit.Role == models.CreditPrimary {
+			primaryField = fmt.Sprintf("artists[%d].artist_id", i)
+			primaryID = credit.ArtistID
+		}
+	}
+
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		primary, err := s.artistRepo.Get(ctx, primaryID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.Invalid(primaryField, "refers to a missing resource")
+			}
+			return err
+		}
+
+		// The artist string of the track follows its primary credit, so that
+		// sorting, search and suggestions agree with the credits.
+		changes := repository.Changes{"artist": primary.Name}
+		if _, err := s.trackRepo.Patch(ctx, id, existing.Version, changes); err != nil {
+			return err
+		}
+
+		return s.artistRepo.SetCredits(ctx, id, repoCredits)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetTrackByID(ctx, id)
+}
+
+func (s *TrackService) DeleteTrack(ctx context.Context, principal *models.Principal, id, version int) error {
+	existing, err := s.getOwnedTrack(ctx, principal, id, version)
+	if err != nil {
+		return err
+	}
+
+	err = s.trackRepo.Delete(ctx, id, existing.Version)
+	if err != nil {
+		return err
+	}
+
+	if existing.StorageKey != "" {
+		s.removeBlob(ctx, existing.StorageKey)
+	}
+
+	if existing.CoverKey != "" {
+		s.removeBlob(ctx, existing.CoverKey)
+	}
+
+	return nil
+}
+
+func (s *TrackService) GetTracks(ctx context.Context, filter *models.TrackFilter, page *models.PageRequest) (*models.Page[*models.Track], error) {
+	repoPage, err := s.trackRepo.GetTracks(ctx, filter, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.convertTrackPage(ctx, repoPage)
+}
+
+// SetReaction records the user's like or dislike of a track, replacing any
+// earlier reaction.
+func (s *TrackService) SetReaction(ctx context.Context, reaction *models.Reaction) (*models.Reaction, error) {
+	value, ok := reactionValues[reaction.Value]
+	if !ok {
+		return nil, ErrInvalidReaction
+	}
+
+	if _, err := s.trackRepo.Get(ctx, reaction.TrackID); err != nil {
+		return nil, err
+	}
+
+	repoReaction := &repository.Reaction{
+		UserID:  reaction.UserID,
+		TrackID: reaction.TrackID,
+		Value:   value,
+	}
+
+	var summary *models.Reaction
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.reactionRepo.Set(ctx, repoReaction); err != nil {
+			return err
+		}
+
+		var err error
+		summary, err = s.reactionSummary(ctx, reaction.UserID, reaction.TrackID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+func (s *TrackService) RemoveReaction(ctx context.Context, userID, trackID int) (*models.Reaction, error) {
+	if _, err := s.trackRepo.Get(ctx, trackID); err != nil {
+		return nil, err
+	}
+
+	var summary *models.Reaction
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.reactionRepo.Delete(ctx, userID, trackID); err != nil {
+			return err
+		}
+
+		var err error
+		summary, err = s.reactionSummary(ctx, userID, trackID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// GetUserTracks returns a page of the tracks uploaded by userID.
+func (s *TrackService) GetUserTracks(ctx context.Context, userID int, page *models.PageRequest) (*models.Page[*models.Track], error) {
+	repoPage, err := s.trackRepo.GetTracksByOwner(ctx, userID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.convertTrackPage(ctx, repoPage)
+}
+
+func (s *TrackService) GetLikedTracks(ctx context.Context, userID int, page *models.PageRequest) (*models.Page[*models.Track], error) {
+	repoPage, err := s.reactionRepo.GetLikedTracks(ctx, userID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.convertTrackPage(ctx, repoPage)
+}
+
+func (s *TrackService) convertTrackPage(ctx context.Context, repoPage *models.Page[*repository.Track]) (*models.Page[*models.Track], error) {
+	tracks, err := s.convertTracks(ctx, repoPage.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	return pageOf(repoPage, tracks), nil
+}
+
+func (s *TrackService) reactionSummary(ctx context.Context, userID, trackID int) (*models.Reaction, error) {
+	track, err := s.trackRepo.Get(ctx, trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	repoReaction, err := s.reactionRepo.Get(ctx, userID, trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	reaction := &models.Reaction{
+		UserID:   userID,
+		TrackID:  trackID,
 		Likes:    track.Likes,
 		Dislikes: track.Dislikes,
 	}
 
-	err = s.trackRepo.Update(ctx, &trackRepo)
+	if repoReaction != nil {
+		for name, value := range reactionValues {
+			if value == repoReaction.Value {
+				reaction.Value = name
+			}
+		}
+	}
+
+	return reaction, nil
+}
+
+// requireVerifiedEmail only lets users who confirmed their email address
+// publish tracks.
+func (s *TrackService) requireVerifiedEmail(ctx context.Context, userID int) error {
+	user, err := s.userRepo.Get(ctx, userID)
 	if err != nil {
 		return err
 	}
 
+	if user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+
 	return nil
 }
 
-func (s *TrackService) DeleteTrack(ctx context.Context, id int) error {
-	err := s.trackRepo.Delete(ctx, id)
+// getOwnedTrack loads the track with the given id and checks that principal
+// uploaded it or is an administrator, and that it is still at version.
+func (s *TrackService) getOwnedTrack(ctx context.Context, principal *models.Principal, id, version int) (*repository.Track, error) {
+	track, err := s.trackRepo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !principal.CanModify(track.OwnerID) {
+		return nil, domain.Forbidden("only the uploader of a track can modify it")
+	}
+
+	if err := domain.CheckVersion("track", track.Version, version); err != nil {
+		return nil, err
+	}
+
+	return track, nil
+}
+
+// insertTrack stores a new track and links it to the catalog: the artist
+// named by its artist string is credited as primary artist and, unless an
+// album ID was given, the album named by its album string becomes its album.
+// Missing artists and albums are created.
+func (s *TrackService) insertTrack(ctx context.Context, track *models.Track, repoTrack *repository.Track) error {
+	artist, err := s.findOrCreateArtist(ctx, track.Artist, track.OwnerID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case track.AlbumID != 0:
+		album, err := s.getAlbum(ctx, track.AlbumID)
+		if err != nil {
+			return err
+		}
+		track.Album = album.Title
+	case track.Album != "":
+		album, err := s.albumRepo.GetByTitle(ctx, artist.ID, track.Album)
+		if errors.Is(err, domain.ErrNotFound) {
+			now := time.Now().UTC()
+			album = &repository.Album{
+				Title:     track.Album,
+				ArtistID:  artist.ID,
+				OwnerID:   track.OwnerID,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			album.ID, err = s.albumRepo.Create(ctx, album)
+		}
+		if err != nil {
+			return err
+		}
+		track.AlbumID = album.ID
+	}
+
+	repoTrack.Album = track.Album
+	repoTrack.AlbumID = track.AlbumID
+
+	id, err := s.trackRepo.Create(ctx, repoTrack)
 	if err != nil {
 		return err
 	}
+	track.ID = id
 
+	err = s.artistRepo.SetCredits(ctx, id, []*repository.Credit{
+		{TrackID: id, ArtistID: artist.ID, Role: models.CreditPrimary},
+	})
+	if err != nil {
+		return err
+	}
+
+	track.Artists = []*models.Credit{{ArtistID: artist.ID, Name: artist.Name, Role: models.CreditPrimary}}
 	return nil
 }
 
-func (s *TrackService) GetTracks(ctx context.Context, name, artist string, playlistID, offset, limit int) ([]*models.Track, error) {
-	repoTracks, err := s.trackRepo.GetTracks(ctx, name, artist, playlistID, offset, limit)
+// findOrCreateArtist returns the artist called name, creating it on behalf
+// of ownerID if there is none.
+func (s *TrackService) findOrCreateArtist(ctx context.Context, name string, ownerID int) (*repository.Artist, error) {
+	artist, err := s.artistRepo.GetByName(ctx, name)
+	if errors.Is(err, domain.ErrNotFound) {
+		now := time.Now().UTC()
+		artist = &repository.Artist{
+			Name:      name,
+			OwnerID:   ownerID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		artist.ID, err = s.artistRepo.Create(ctx, artist)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return artist, nil
+}
+
+// setPrimaryArtist credits the artist called name as the only primary artist
+// of a track whose artist string changed. Other credits are kept.
+func (s *TrackService) setPrimaryArtist(ctx context.Context, trackID int, name string, ownerID int) error {
+	artist, err := s.findOrCreateArtist(ctx, name, ownerID)
+	if err != nil {
+		return err
+	}
+
+	credits, err := s.artistRepo.GetCredits(ctx, []int{trackID})
+	if err != nil {
+		return err
+	}
+
+	updated := []*repository.Credit{{TrackID: trackID, ArtistID: artist.ID, Role: models.CreditPrimary}}
+	for _, credit := range credits[trackID] {
+		if credit.Role != models.CreditPrimary {
+			updated = append(updated, credit)
+		}
+	}
+
+	return s.artistRepo.SetCredits(ctx, trackID, updated)
+}
+
+// getAlbum loads an album a track refers to. A missing album is reported as
+// an invalid album_id.
+func (s *TrackService) getAlbum(ctx context.Context, id int) (*repository.Album, error) {
+	album, err := s.albumRepo.Get(ctx, id)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, domain.Invalid("album_id", "refers to a missing resource")
+	}
+	return album, err
+}
+
+// convertTracks converts repoTracks to models and loads their credits in a
+// single query.
+func (s *TrackService) convertTracks(ctx context.Context, repoTracks []*repository.Track) ([]*models.Track, error) {
+	ids := make([]int, 0, len(repoTracks))
+	for _, repoTrack := range repoTracks {
+		ids = append(ids, repoTrack.ID)
+	}
+
+	credits, err := s.artistRepo.GetCredits(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
 
 	var tracks []*models.Track
 	for _, repoTrack := range repoTracks {
-		track := &models.Track{
-			ID:       repoTrack.ID,
-			Name:     repoTrack.Name,
-			Artist:   repoTrack.Artist,
-			URL:      repoTrack.URL,
-			Likes:    repoTrack.Likes,
-			Dislikes: repoTrack.Dislikes,
-		}
-		tracks = append(tracks, track)
+		tracks = append(tracks, convertTrack(repoTrack, credits[repoTrack.ID]))
 	}
 
 	return tracks, nil
 }
+
+// convertTrack converts repoTrack to a model credited to credits. Tracks
+// without credits list none rather than null.
+func convertTrack(repoTrack *repository.Track, credits []*repository.Credit) *models.Track {
+	track := repoTrack.ConvertToModel()
+	track.Artists = []*models.Credit{}
+	for _, credit := range credits {
+		track.Artists = append(track.Artists, &models.Credit{
+			ArtistID: credit.ArtistID,
+			Name:     credit.Name,
+			Role:     credit.Role,
+		})
+	}
+
+	return track
+}
+
+func validateCredits(credits []*models.Credit) error {
+	var validation domain.Validation
+
+	type key struct {
+		artistID int
+		role     string
+	}
+	seen := make(map[key]bool)
+	primaries := 0
+
+	for i, credit := range credits {
+		field := fmt.Sprintf("artists[%d]", i)
+
+		switch credit.Role {
+		case models.CreditPrimary, models.CreditFeatured, models.CreditRemixer:
+		default:
+			validation.Add(field+".role", "must be one of primary, featured or remixer")
+		}
+
+		if credit.ArtistID <= 0 {
+			validation.Add(field+".artist_id", "is required")
+		}
+
+		k := key{credit.ArtistID, credit.Role}
+		if seen[k] {
+			validation.Add(field, "credits the same artist twice in one role")
+		}
+		seen[k] = true
+
+		if credit.Role == models.CreditPrimary {
+			primaries++
+		}
+	}
+
+	if primaries != 1 {
+		validation.Add("artists", "must credit exactly one primary artist")
+	}
+
+	return validation.Err()
+}
+
+func (s *TrackService) openBlob(ctx context.Context, key string) (io.ReadSeekCloser, time.Time, error) {
+	if key == "" {
+		return nil, time.Time{}, ErrTrackNotHosted
+	}
+
+	r, info, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			return nil, time.Time{}, ErrTrackNotHosted
+		}
+		return nil, time.Time{}, err
+	}
+
+	return r, info.ModTime, nil
+}
+
+// storeCover saves embedded cover art and returns its storage key. Cover art
+// is optional, so failures are only logged.
+func (s *TrackService) storeCover(ctx context.Context, picture *media.Picture) string {
+	mime := mimetype.Detect(picture.Data)
+	if !strings.HasPrefix(mime.String(), "image/") {
+		s.logger.Warn("Ignoring embedded cover art", slog.String("mime", mime.String()))
+		return ""
+	}
+
+	key, err := newStorageKey("covers", mime.Extension())
+	if err != nil {
+		s.logger.Error("Failed to store cover art", slog.Any("error", err))
+		return ""
+	}
+
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(picture.Data), mime.String()); err != nil {
+		s.logger.Error("Failed to store cover art", slog.Any("error", err))
+		return ""
+	}
+
+	return key
+}
+
+func (s *TrackService) removeBlob(ctx context.Context, key string) {
+	if err := s.blobs.Delete(ctx, key); err != nil {
+		s.logger.Error("Failed to delete stored file", slog.String("key", key), slog.Any("error", err))
+	}
+}
+
+// applyTags fills fields the uploader left empty with values embedded in the file.
+func applyTags(track *models.Track, tags *media.Tags) {
+	if track.Name == "" {
+		track.Name = tags.Title
+	}
+	if track.Artist == "" {
+		track.Artist = tags.Artist
+	}
+	if track.Album == "" {
+		track.Album = tags.Album
+	}
+	if track.Genre == "" {
+		track.Genre = tags.Genre
+	}
+	if track.TrackNumber == 0 {
+		track.TrackNumber = tags.TrackNumber
+	}
+	if track.Year == 0 {
+		track.Year = tags.Year
+	}
+	if track.DurationMs == 0 {
+		track.DurationMs = int(tags.Duration.Milliseconds())
+	}
+}
+
+// applyAudioInfo copies properties measured from the stream headers. The
+// measured duration wins over the one declared in the tags.
+func applyAudioInfo(track *models.Track, info *media.Info) {
+	if info.Duration > 0 {
+		track.DurationMs = int(info.Duration.Milliseconds())
+	}
+	track.Bitrate = info.Bitrate
+	track.Codec = info.Codec
+	track.SampleRate = info.SampleRate
+	track.Channels = info.Channels
+}
+
+var reactionValues = map[string]int{
+	models.ReactionLike:    1,
+	models.ReactionDislike: -1,
+}
+
+func isAudio(mime *mimetype.MIME) bool {
+	for m := mime; m != nil; m = m.Parent() {
+		if strings.HasPrefix(m.String(), "audio/") || m.Is("application/ogg") {
+			return true
+		}
+	}
+	return false
+}
+
+func newStorageKey(prefix, ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", fmt.Errorf("failed to generate storage key: %w", err)
+	}
+	return prefix + "/" + hex.EncodeToString(b) + ext, nil
+}
+
+func streamURL(id int) string {
+	return fmt.Sprintf("/api/v1/tracks/%d/stream", id)
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
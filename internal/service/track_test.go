@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"testing"
+)
+
+func TestValidateCredits(t *testing.T) {
+	primary := &models.Credit{ArtistID: 1, Role: models.CreditPrimary}
+	featured := &models.Credit{ArtistID: 2, Role: models.CreditFeatured}
+
+	tests := []struct {
+		name    string
+		credits []*models.Credit
+		wantErr bool
+	}{
+		{"one primary", []*models.Credit{primary}, false},
+		{"one primary and others", []*models.Credit{featured, primary, {ArtistID: 3, Role: models.CreditRemixer}}, false},
+		{"no credits", nil, true},
+		{"no primary", []*models.Credit{featured}, true},
+		{"two primaries", []*models.Credit{primary, {ArtistID: 2, Role: models.CreditPrimary}}, true},
+		{"unknown role", []*models.Credit{primary, {ArtistID: 2, Role: "producer"}}, true},
+		{"missing artist", []*models.Credit{{Role: models.CreditPrimary}}, true},
+		{"same artist twice in one role", []*models.Credit{primary, featured, featured}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCredits(tt.credits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateCredits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, domain.ErrValidation) {
+				t.Errorf("validateCredits() error = %v, want a validation error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"music-hosting/internal/auth"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"music-hosting/internal/repository"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer          = "Music Hosting"
+	challengeTokenTTL   = 5 * time.Minute
+	recoveryCodeCount   = 10
+	recoveryCodeBytes   = 5
+	recoveryCodeGroupAt = 4
+
+	// maxTwoFactorFailures invalid codes lock every check of a code, at
+	// login as well as when confirming or disabling two-factor
+	// authentication, for twoFactorLockout after the last of them. The TOTP
+	// window accepts three codes at a time, so each lockout leaves a
+	// guesser about a 1 in 67000 chance. Recovery codes count against the
+	// same limit.
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+var (
+	ErrInvalidTwoFactorCode    = domain.Invalid("code", "is invalid or was already used")
+	ErrInvalidChallengeToken   = domain.Unauthorized("invalid challenge token or two-factor code")
+	ErrTwoFactorAlreadyEnabled = domain.New(domain.ErrConflict, "two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = domain.New(domain.ErrConflict, "two-factor authentication is not enabled")
+	ErrTwoFactorLocked         = domain.New(domain.ErrTooManyRequests, "too many invalid two-factor codes, try again later")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTwoFactor generates a TOTP secret and recovery codes for userID.
+// Two-factor authentication is only enforced once a code generated from the
+// secret has been confirmed with ConfirmTwoFactor.
+func (s *UserService) EnrollTwoFactor(ctx context.Context, userID int) (*models.TwoFactorEnrollment, error) {
+	user, err := s.userRepo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.SetTOTPSecret(ctx, userID, secret); err != nil {
+			return err
+		}
+
+		return s.userRepo.ReplaceRecoveryCodes(ctx, userID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorEnrollment{
+		Secret:        secret,
+		URI:           auth.TOTPURI(totpIssuer, user.Login, secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves
+// their authenticator produces valid codes.
+func (s *UserService) ConfirmTwoFactor(ctx context.Context, userID int, code string) error {
+	_, err := s.attemptTwoFactor(ctx, userID, code, twoFactorAttempt{
+		ready: func(user *repository.User) error {
+			if user.TOTPEnabled {
+				return ErrTwoFactorAlreadyEnabled
+			}
+			if user.TOTPSecret == "" {
+				return ErrTwoFactorNotEnabled
+			}
+			return nil
+		},
+		check: s.checkTOTP,
+		succeed: func(ctx context.Context, user *repository.User) error {
+			return s.userRepo.EnableTOTP(ctx, user.ID)
+		},
+	})
+	return err
+}
+
+// DisableTwoFactor turns two-factor authentication off. A current code or an
+// unused recovery code is required.
+func (s *UserService) DisableTwoFactor(ctx context.Context, userID int, code string) error {
+	_, err := s.attemptTwoFactor(ctx, userID, code, twoFactorAttempt{
+		ready: func(user *repository.User) error {
+			if !user.TOTPEnabled {
+				return ErrTwoFactorNotEnabled
+			}
+			return nil
+		},
+		check: s.checkSecondFactor,
+		succeed: func(ctx context.Context, user *repository.User) error {
+			return s.userRepo.DisableTOTP(ctx, user.ID)
+		},
+	})
+	return err
+}
+
+// CompleteTwoFactorLogin exchanges a challenge token from GetToken and a
+// TOTP or recovery code for a token pair.
+func (s *UserService) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code string) (*models.Tokens, error) {
+	userID, err := s.keys.ValidateChallengeToken(challengeToken)
+	if err != nil {
+		return nil, ErrInvalidChallengeToken
+	}
+
+	user, err := s.attemptTwoFactor(ctx, userID, code, twoFactorAttempt{
+		ready: func(user *repository.User) error {
+			if !user.TOTPEnabled {
+				return ErrInvalidChallengeToken
+			}
+			return nil
+		},
+		check: s.checkSecondFactor,
+	})
+	// A wrong code fails the login as a whole rather than the request
+	// field.
+	if errors.Is(err, domain.ErrNotFound) || errors.Is(err, ErrInvalidTwoFactorCode) {
+		return nil, ErrInvalidChallengeToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// twoFactorAttempt describes one use of a second factor. ready rejects
+// accounts the attempt does not apply to, check verifies the code and
+// succeed, if set, runs in the same unit of work once the code was accepted.
+type twoFactorAttempt struct {
+	ready   func(user *repository.User) error
+	check   func(ctx context.Context, user *repository.User, code string) error
+	succeed func(ctx context.Context, user *repository.User) error
+}
+
+// attemptTwoFactor checks a code for userID under the lockout that applies
+// to every check of a code, wherever it is entered, and returns the user it
+// was checked for.
+func (s *UserService) attemptTwoFactor(ctx context.Context, userID int, code string, attempt twoFactorAttempt) (*repository.User, error) {
+	var user *repository.User
+	var rejected error
+
+	err := s.tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.userRepo.LockTwoFactor(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := attempt.ready(user); err != nil {
+			rejected = err
+			return nil
+		}
+
+		now := time.Now().UTC()
+		if twoFactorLocked(user.TOTPFailures, user.TOTPFailedAt, now) {
+			rejected = ErrTwoFactorLocked
+			return nil
+		}
+
+		if err := attempt.check(ctx, user, code); err != nil {
+			if !errors.Is(err, ErrInvalidTwoFactorCode) {
+				return err
+			}
+
+			// The failure is committed, so the error is reported once the
+			// unit of work is over.
+			rejected = err
+			failures := countTwoFactorFailure(user.TOTPFailures, user.TOTPFailedAt, now)
+			return s.userRepo.SetTwoFactorFailures(ctx, user.ID, failures, &now)
+		}
+
+		if user.TOTPFailures != 0 {
+			if err := s.userRepo.SetTwoFactorFailures(ctx, user.ID, 0, nil); err != nil {
+				return err
+			}
+		}
+
+		if attempt.succeed == nil {
+			return nil
+		}
+		return attempt.succeed(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rejected != nil {
+		return nil, rejected
+	}
+
+	return user, nil
+}
+
+// twoFactorLocked reports whether failures invalid codes, the last of them
+// entered at failedAt, keep codes from being checked at now.
+func twoFactorLocked(failures int, failedAt *time.Time, now time.Time) bool {
+	return failures >= maxTwoFactorFailures && failedAt != nil && now.Sub(*failedAt) < twoFactorLockout
+}
+
+// countTwoFactorFailure returns the number of invalid codes after one more
+// at now. Failures older than the lockout are forgotten.
+func countTwoFactorFailure(failures int, failedAt *time.Time, now time.Time) int {
+	if failedAt == nil || now.Sub(*failedAt) >= twoFactorLockout {
+		return 1
+	}
+	return failures + 1
+}
+
+// beginTwoFactorLogin issues the challenge token returned by GetToken for
+// accounts with two-factor authentication enabled.
+func (s *UserService) beginTwoFactorLogin(user *repository.User) (*models.LoginResult, error) {
+	token, err := s.keys.GenerateChallengeToken(user.ID, challengeTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginResult{
+		ChallengeToken:     token,
+		ChallengeExpiresIn: challengeTokenTTL,
+	}, nil
+}
+
+func (s *UserService) checkSecondFactor(ctx context.Context, user *repository.User, code string) error {
+	if isRecoveryCode(code) {
+		used, err := s.userRepo.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	return s.checkTOTP(ctx, user, code)
+}
+
+func (s *UserService) checkTOTP(ctx context.Context, user *repository.User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	// Each code is accepted once, so an intercepted code cannot be replayed
+	// within its validity window.
+	fresh, err := s.userRepo.UseTOTPStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// generateRecoveryCodes returns recovery codes formatted for display, such
+// as "abcd-efgh", along with the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, code[:recoveryCodeGroupAt]+"-"+code[recoveryCodeGroupAt:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// isRecoveryCode tells recovery codes apart from numeric TOTP codes.
+func isRecoveryCode(code string) bool {
+	return len(normalizeRecoveryCode(code)) == recoveryCodeEncoding.EncodedLen(recoveryCodeBytes)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestTwoFactorLockout replays a run of invalid codes against the lockout
+// the way CompleteTwoFactorLogin records them.
+func TestTwoFactorLockout(t *testing.T) {
+	start := time.Date(2025, 2, 9, 12, 0, 0, 0, time.UTC)
+
+	var failures int
+	var failedAt *time.Time
+	fail := func(now time.Time) {
+		failures = countTwoFactorFailure(failures, failedAt, now)
+		failedAt = &now
+	}
+
+	now := start
+	for i := 1; i < maxTwoFactorFailures; i++ {
+		fail(now)
+		now = now.Add(10 * time.Second)
+		if twoFactorLocked(failures, failedAt, now) {
+			t.Fatalf("locked after %d invalid codes, want %d", i, maxTwoFactorFailures)
+		}
+	}
+
+	fail(now)
+	last := now
+	if !twoFactorLocked(failures, failedAt, now.Add(time.Second)) {
+		t.Fatalf("attempt after %d invalid codes allowed, want it rejected", maxTwoFactorFailures)
+	}
+	if !twoFactorLocked(failures, failedAt, last.Add(twoFactorLockout-time.Second)) {
+		t.Error("lockout ended early")
+	}
+	if twoFactorLocked(failures, failedAt, last.Add(twoFactorLockout)) {
+		t.Error("still locked once the lockout is over")
+	}
+
+	// After the lockout the count starts over, rather than locking again
+	// on the next invalid code.
+	fail(last.Add(twoFactorLockout))
+	if failures != 1 {
+		t.Errorf("failures after the lockout = %d, want 1", failures)
+	}
+	if twoFactorLocked(failures, failedAt, last.Add(twoFactorLockout+time.Second)) {
+		t.Error("locked again by the first invalid code after the lockout")
+	}
+}
+
+func TestTwoFactorLockoutForgetsOldFailures(t *testing.T) {
+	start := time.Date(2025, 2, 9, 12, 0, 0, 0, time.UTC)
+
+	var failures int
+	var failedAt *time.Time
+	for i := 0; i < 3*maxTwoFactorFailures; i++ {
+		now := start.Add(time.Duration(i) * twoFactorLockout)
+		failures = countTwoFactorFailure(failures, failedAt, now)
+		failedAt = &now
+		if twoFactorLocked(failures, failedAt, now) {
+			t.Fatalf("locked by invalid codes spread over %s", time.Duration(i)*twoFactorLockout)
+		}
+	}
+}
+
+func TestCompleteTwoFactorLoginLockout(t *testing.T) {
+	const recoveryCode = "abcd-efgh"
+	recentFailure := time.Now().UTC().Add(-time.Minute)
+
+	expectUser := func(mock sqlmock.Sqlmock, failures int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, login, role, .* FROM users WHERE id = \$1 FOR UPDATE`).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{
+				"id", "login", "role", "totp_secret", "totp_enabled", "totp_last_step", "totp_failures", "totp_failed_at",
+			}).AddRow(7, "alice", "listener", "JBSWY3DPEHPK3PXP", true, 0, failures, recentFailure))
+	}
+
+	t.Run("the last allowed invalid code is counted", func(t *testing.T) {
+		s, mock := newTestUserService(t)
+		challenge, err := s.keys.GenerateChallengeToken(7, challengeTokenTTL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectUser(mock, maxTwoFactorFailures-1)
+		mock.ExpectExec(`UPDATE user_recovery_codes SET used_at = NOW\(\)`).
+			WithArgs(7, hashRecoveryCode(recoveryCode)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`UPDATE users SET totp_failures = \$1, totp_failed_at = \$2 WHERE id = \$3`).
+			WithArgs(maxTwoFactorFailures, sqlmock.AnyArg(), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, err = s.CompleteTwoFactorLogin(context.Background(), challenge, recoveryCode)
+		if !errors.Is(err, ErrInvalidChallengeToken) {
+			t.Errorf("CompleteTwoFactorLogin() error = %v, want %v", err, ErrInvalidChallengeToken)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("the next attempt is rejected without checking the code", func(t *testing.T) {
+		s, mock := newTestUserService(t)
+		challenge, err := s.keys.GenerateChallengeToken(7, challengeTokenTTL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectUser(mock, maxTwoFactorFailures)
+		mock.ExpectCommit()
+
+		_, err = s.CompleteTwoFactorLogin(context.Background(), challenge, recoveryCode)
+		if !errors.Is(err, ErrTwoFactorLocked) {
+			t.Errorf("CompleteTwoFactorLogin() error = %v, want %v", err, ErrTwoFactorLocked)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestManageTwoFactorLockout(t *testing.T) {
+	// Not made of digits, so it never matches by chance.
+	const code = "00000x"
+	recentFailure := time.Now().UTC().Add(-time.Minute)
+
+	tests := []struct {
+		name    string
+		enabled bool
+		call    func(s *UserService) error
+	}{
+		{
+			name: "confirm",
+			call: func(s *UserService) error { return s.ConfirmTwoFactor(context.Background(), 7, code) },
+		},
+		{
+			name:    "disable",
+			enabled: true,
+			call:    func(s *UserService) error { return s.DisableTwoFactor(context.Background(), 7, code) },
+		},
+	}
+
+	expectUser := func(mock sqlmock.Sqlmock, enabled bool, failures int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT id, login, role, .* FROM users WHERE id = \$1 FOR UPDATE`).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{
+				"id", "login", "role", "totp_secret", "totp_enabled", "totp_last_step", "totp_failures", "totp_failed_at",
+			}).AddRow(7, "alice", "listener", "JBSWY3DPEHPK3PXP", enabled, 0, failures, recentFailure))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" counts an invalid code", func(t *testing.T) {
+			s, mock := newTestUserService(t)
+
+			expectUser(mock, tt.enabled, maxTwoFactorFailures-1)
+			mock.ExpectExec(`UPDATE users SET totp_failures = \$1, totp_failed_at = \$2 WHERE id = \$3`).
+				WithArgs(maxTwoFactorFailures, sqlmock.AnyArg(), 7).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			if err := tt.call(s); !errors.Is(err, ErrInvalidTwoFactorCode) {
+				t.Errorf("error = %v, want %v", err, ErrInvalidTwoFactorCode)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run(tt.name+" is locked after too many invalid codes", func(t *testing.T) {
+			s, mock := newTestUserService(t)
+
+			expectUser(mock, tt.enabled, maxTwoFactorFailures)
+			mock.ExpectCommit()
+
+			if err := tt.call(s); !errors.Is(err, ErrTwoFactorLocked) {
+				t.Errorf("error = %v, want %v", err, ErrTwoFactorLocked)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
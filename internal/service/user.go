@@ -3,20 +3,50 @@ package service
 import (
 	"context"
 	"log/slog"
+	"music-hosting/internal/auth"
+	"music-hosting/internal/config"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/mailer"
 	"music-hosting/internal/models"
 	"music-hosting/internal/repository"
-	"strconv"
+	"strings"
 )
 
+var ErrInvalidRole = domain.Invalid("role", "must be one of admin, artist or listener")
+
 type UserService struct {
-	userRepo *repository.UserStorage
-	logger   *slog.Logger
+	userRepo    *repository.UserStorage
+	sessionRepo *repository.SessionStorage
+	tokenRepo   *repository.UserTokenStorage
+	tx          *repository.TxManager
+	keys        *auth.KeyManager
+	mailer      mailer.Mailer
+	authCfg     *config.AuthConfig
+	publicURL   string
+	logger      *slog.Logger
 }
 
-func NewUserService(userRepo *repository.UserStorage, logger *slog.Logger) *UserService {
+func NewUserService(
+	userRepo *repository.UserStorage,
+	sessionRepo *repository.SessionStorage,
+	tokenRepo *repository.UserTokenStorage,
+	tx *repository.TxManager,
+	keys *auth.KeyManager,
+	mailer mailer.Mailer,
+	authCfg *config.AuthConfig,
+	publicURL string,
+	logger *slog.Logger,
+) *UserService {
 	return &UserService{
-		userRepo: userRepo,
-		logger:   logger,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		tokenRepo:   tokenRepo,
+		tx:          tx,
+		keys:        keys,
+		mailer:      mailer,
+		authCfg:     authCfg,
+		publicURL:   strings.TrimSuffix(publicURL, "/"),
+		logger:      logger,
 	}
 }
 
@@ -26,7 +56,7 @@ func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
 		return err
 	}
 
-	hashedPassword, salt, err := HashPassword(user.Password)
+	hashedPassword, err := HashPassword(user.Password)
 	if err != nil {
 		return err
 	}
@@ -36,7 +66,7 @@ func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
 		Login:    user.Login,
 		Email:    user.Email,
 		Password: hashedPassword,
-		Salt:     salt,
+		Role:     models.RoleListener,
 	}
 
 	id, err := s.userRepo.Create(ctx, &repoUser)
@@ -45,6 +75,12 @@ func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
 	}
 
 	user.ID = id
+	repoUser.ID = id
+
+	// The account is usable without a verified address, so a failed
+	// delivery is not an error; the user can ask for another email.
+	_ = s.sendVerificationEmail(ctx, &repoUser)
+
 	return nil
 }
 
@@ -58,27 +94,25 @@ func (s *UserService) GetUser(ctx context.Context, id int) (*models.User, error)
 		ID:    repoUser.ID,
 		Login: repoUser.Login,
 		Email: repoUser.Email,
+		Role:  repoUser.Role,
 	}
 
 	return user, nil
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, id int, user *models.User) error {
-	err := ValidateUser(user)
-	if err != nil {
-		return err
+func (s *UserService) UpdateUser(ctx context.Context, principal *models.Principal, id int, user *models.User) error {
+	if !principal.CanModify(id) {
+		return domain.Forbidden("you can only modify your own account")
 	}
 
-	hashedPassword, salt, err := HashPassword(user.Password)
+	err := ValidateProfile(user)
 	if err != nil {
 		return err
 	}
 
 	repoUser := &repository.User{
-		Login:    user.Login,
-		Email:    user.Email,
-		Password: hashedPassword,
-		Salt:     salt,
+		Login: user.Login,
+		Email: user.Email,
 	}
 	err = s.userRepo.Update(ctx, repoUser, id)
 	if err != nil {
@@ -88,45 +122,141 @@ func (s *UserService) UpdateUser(ctx context.Context, id int, user *models.User)
 	return nil
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, userID int) error {
-	err := s.userRepo.Delete(ctx, userID)
+// PatchUser applies a merge patch to the login and email of user id and
+// returns the updated user.
+func (s *UserService) PatchUser(ctx context.Context, principal *models.Principal, id int, patch *models.UserPatch) (*models.User, error) {
+	if !principal.CanModify(id) {
+		return nil, domain.Forbidden("you can only modify your own account")
+	}
+
+	repoUser, err := s.userRepo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		ID:    repoUser.ID,
+		Login: repoUser.Login,
+		Email: repoUser.Email,
+		Role:  repoUser.Role,
+	}
+
+	changes := repository.Changes{}
+	patchField(changes, "login", patch.Login, &user.Login)
+	patchField(changes, "email", patch.Email, &user.Email)
+
+	if err := ValidateProfile(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.Patch(ctx, id, changes); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces the password of the principal's account after
+// checking the current one. Every other session of the account is ended.
+func (s *UserService) ChangePassword(ctx context.Context, principal *models.Principal, currentPassword, newPassword string) error {
+	var validation domain.Validation
+	if currentPassword == "" {
+		validation.Add("current_password", "is required")
+	}
+	if newPassword == "" {
+		validation.Add("new_password", "is required")
+	}
+	if err := validation.Err(); err != nil {
+		return err
+	}
+
+	storedHash, storedSalt, err := s.userRepo.GetPasswordHash(ctx, principal.UserID)
 	if err != nil {
 		return err
 	}
 
-	err = s.userRepo.RemovePlaylistsFromUser(ctx, userID)
+	valid, err := CheckPassword(currentPassword, storedHash, storedSalt)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if !valid {
+		return domain.Invalid("current_password", "is incorrect")
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.UpdatePassword(ctx, principal.UserID, hashedPassword); err != nil {
+			return err
+		}
+
+		return s.sessionRepo.RevokeOthersForUser(ctx, principal.UserID, principal.SessionID)
+	})
 }
 
-func (s *UserService) GetUsersWithPagination(ctx context.Context, limit, offset string) ([]*models.User, error) {
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil || limitInt < 1 {
-		return nil, err
+func (s *UserService) DeleteUser(ctx context.Context, principal *models.Principal, id int) error {
+	if !principal.CanModify(id) {
+		return domain.Forbidden("you can only delete your own account")
 	}
 
-	offsetInt, err := strconv.Atoi(offset)
-	if err != nil || offsetInt < 0 {
-		return nil, err
+	// Playlists reference the user without cascading, so they go first.
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.RemovePlaylistsFromUser(ctx, id); err != nil {
+			return err
+		}
+
+		return s.userRepo.Delete(ctx, id)
+	})
+}
+
+func (s *UserService) UpdateUserRole(ctx context.Context, id int, role string) error {
+	if !isValidRole(role) {
+		return ErrInvalidRole
+	}
+
+	if _, err := s.userRepo.Get(ctx, id); err != nil {
+		return err
 	}
 
-	repoUsers, err := s.userRepo.GetUsers(ctx, offsetInt, limitInt)
+	return s.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.UpdateRole(ctx, id, role); err != nil {
+			return err
+		}
+
+		// Access tokens carry the role, so sessions issued with the old one
+		// are ended.
+		return s.sessionRepo.RevokeAllForUser(ctx, id)
+	})
+}
+
+func isValidRole(role string) bool {
+	switch role {
+	case models.RoleAdmin, models.RoleArtist, models.RoleListener:
+		return true
+	}
+	return false
+}
+
+func (s *UserService) GetUsersWithPagination(ctx context.Context, page *models.PageRequest) (*models.Page[*models.User], error) {
+	repoPage, err := s.userRepo.GetUsers(ctx, page)
 	if err != nil {
 		return nil, err
 	}
 
 	var users []*models.User
-	for _, repoUser := range repoUsers {
+	for _, repoUser := range repoPage.Items {
 		user := &models.User{
 			ID:    repoUser.ID,
 			Login: repoUser.Login,
 			Email: repoUser.Email,
+			Role:  repoUser.Role,
 		}
 		users = append(users, user)
 	}
 
-	return users, nil
+	return pageOf(repoPage, users), nil
 }
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"music-hosting/internal/domain"
+	"music-hosting/internal/models"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestDeleteUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		deleted int64
+		wantErr error
+	}{
+		{name: "existing user", deleted: 1},
+		{name: "missing user", deleted: 0, wantErr: domain.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestUserService(t)
+			admin := &models.Principal{UserID: 1, Role: models.RoleAdmin}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`DELETE FROM playlists WHERE user_id = \$1`).
+				WithArgs(7).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`DELETE FROM users WHERE id = \$1`).
+				WithArgs(7).
+				WillReturnResult(sqlmock.NewResult(0, tt.deleted))
+			if tt.wantErr == nil {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err := s.DeleteUser(context.Background(), admin, 7)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteUser() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound            = errors.New("blob not found")
+	ErrPresignNotSupported = errors.New("presigned URLs are not supported by this storage")
+)
+
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Store is implemented by every backend that can hold uploaded media.
+// Keys are slash separated paths such as "tracks/<id>.mp3".
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, *Info, error)
+	Stat(ctx context.Context, key string) (*Info, error)
+	Delete(ctx context.Context, key string) error
+	// Presign returns a URL that grants read access to the object for ttl
+	// without further authentication, or ErrPresignNotSupported.
+	Presign(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
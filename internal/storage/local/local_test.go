@@ -0,0 +1,24 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"music-hosting/internal/storage/blob"
+	"testing"
+	"time"
+)
+
+func TestPresignNotSupported(t *testing.T) {
+	storage, err := NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+
+	url, err := storage.Presign(context.Background(), "tracks/1.mp3", time.Minute)
+	if !errors.Is(err, blob.ErrPresignNotSupported) {
+		t.Errorf("Presign error = %v, want %v", err, blob.ErrPresignNotSupported)
+	}
+	if url != "" {
+		t.Errorf("Presign URL = %q, want none", url)
+	}
+}
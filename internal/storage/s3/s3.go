@@ -0,0 +1,345 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"music-hosting/internal/config"
+	"music-hosting/internal/storage/blob"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// bucketCheckTimeout bounds the bucket check at startup, so that an
+	// unreachable endpoint fails the boot instead of hanging it.
+	bucketCheckTimeout = 10 * time.Second
+
+	// maxPresignTTL is the longest validity S3 accepts for a presigned URL.
+	maxPresignTTL = 7 * 24 * time.Hour
+)
+
+// Storage talks to any S3-compatible object store (AWS S3, MinIO, ...)
+// using plain HTTP requests signed with AWS Signature Version 4.
+type Storage struct {
+	endpoint  *url.URL
+	bucket    string
+	pathStyle bool
+	signer    *signer
+	client    *http.Client
+}
+
+func NewStorage(cfg *config.S3StorageConfig) (*Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("incomplete s3 configuration: endpoint=%s, bucket=%s", cfg.Endpoint, cfg.Bucket)
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %q", cfg.Endpoint)
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	s := &Storage{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		pathStyle: cfg.PathStyle,
+		signer: &signer{
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			region:    region,
+		},
+		client: &http.Client{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bucketCheckTimeout)
+	defer cancel()
+
+	if err := s.ensureBucket(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Storage) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	// S3 needs the object length up front, so the upload is spooled to a
+	// temporary file first.
+	tmp, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return fmt.Errorf("failed to buffer upload: %w", err)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind upload: %w", err)
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, tmp)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError("put", key, resp)
+	}
+
+	return nil
+}
+
+func (s *Storage) Get(ctx context.Context, key string) (io.ReadSeekCloser, *blob.Info, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &object{ctx: ctx, storage: s, key: key, size: info.Size}, info, nil
+}
+
+func (s *Storage) Stat(ctx context.Context, key string) (*blob.Info, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, blob.ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("stat", key, resp)
+	}
+
+	info := &blob.Info{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+
+	return info, nil
+}
+
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError("delete", key, resp)
+	}
+
+	return nil
+}
+
+// Presign returns a query-string authenticated GET URL for key that is
+// valid for ttl, which must be between one second and seven days.
+func (s *Storage) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	if ttl < time.Second || ttl > maxPresignTTL {
+		return "", fmt.Errorf("invalid presign ttl: %s", ttl)
+	}
+
+	u := s.objectURL(key)
+	s.signer.presign(http.MethodGet, u, ttl, time.Now())
+	return u.String(), nil
+}
+
+func (s *Storage) ensureBucket(ctx context.Context) error {
+	req, err := s.newRequest(ctx, http.MethodHead, "", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return responseError("head bucket", s.bucket, resp)
+	}
+
+	req, err = s.newRequest(ctx, http.MethodPut, "", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err = s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError("create bucket", s.bucket, resp)
+	}
+
+	return nil
+}
+
+func (s *Storage) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build s3 request: %w", err)
+	}
+	return req, nil
+}
+
+func (s *Storage) do(req *http.Request) (*http.Response, error) {
+	s.signer.sign(req, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func (s *Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket
+		if key != "" {
+			u.Path += "/" + key
+		}
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = ""
+	return &u
+}
+
+func responseError(op, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %q failed: %s: %s", op, key, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// object reads an S3 object lazily with ranged GET requests, which lets
+// http.ServeContent seek around without downloading the whole file.
+type object struct {
+	ctx     context.Context
+	storage *Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (o *object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		req, err := o.storage.newRequest(o.ctx, http.MethodGet, o.key, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(o.offset, 10)+"-")
+
+		resp, err := o.storage.do(req)
+		if err != nil {
+			return 0, err
+		}
+		// A 200 carries the object from its start, which is only what was
+		// asked for when reading from there.
+		if resp.StatusCode != http.StatusPartialContent && (resp.StatusCode != http.StatusOK || o.offset != 0) {
+			defer resp.Body.Close()
+			return 0, responseError("get", o.key, resp)
+		}
+		o.body = resp.Body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if errors.Is(err, io.EOF) && o.offset < o.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.offset + offset
+	case io.SeekEnd:
+		abs = o.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position: %d", abs)
+	}
+
+	if abs != o.offset {
+		o.closeBody()
+		o.offset = abs
+	}
+
+	return abs, nil
+}
+
+func (o *object) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *object) closeBody() {
+	if o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+}